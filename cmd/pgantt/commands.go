@@ -0,0 +1,345 @@
+//------------------------------------------------------------------------------
+// Copyright (C) 2021 Daedalean AG
+//
+// This file is part of PGantt.
+//
+// PGantt is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// PGantt is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with PGantt.  If not, see <https://www.gnu.org/licenses/>.
+//------------------------------------------------------------------------------
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/daedaleanai/pgantt/pkg/pgantt"
+)
+
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(fs *flag.FlagSet, opts *pgantt.Opts, args []string) error
+}
+
+var commands = []command{
+	{"serve", "", "Serve the chart in the browser (the default)", runServe},
+	{"export", "-project NAME [-format csv|json|mspdi] [-output FILE]",
+		"Write the plan of a project to a file or to the standard output", runExport},
+	{"validate", "-project NAME [-json]",
+		"Check the links of a project; fails if there are any problems", runValidate},
+	{"sync-check", "[-json]",
+		"Compare the cached state against a full sync; fails if they differ", runSyncCheck},
+	{"import", "-project NAME [-format csv|mspdi] [-dry-run] FILE",
+		"Create the tasks listed in a CSV or MSPDI file", runImport},
+	{"report", "-project NAME [-weeks N] [-format markdown|html] [-record] [-phriction SLUG] [-output FILE]",
+		"Write a status report of a project or post it to Phriction", runReport},
+}
+
+func printUsage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [flags] [command] [command flags]\n\nCommands:\n", os.Args[0])
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %s %s\n    \t%s\n", cmd.name, cmd.usage, cmd.summary)
+	}
+	fmt.Fprintf(out, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+// The formats are named after the file extensions in the API, but MSPDI is
+// more telling on the command line
+func formatName(format string) string {
+	if format == "mspdi" {
+		return pgantt.FormatMSPDI
+	}
+	return format
+}
+
+func (cmd *command) flags() *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s %s %s\n\n%s\n", os.Args[0], cmd.name, cmd.usage, cmd.summary)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// Set up the state and resolve the project given on the command line
+func openProject(opts *pgantt.Opts, project string) (*pgantt.StateManager, string, error) {
+	if project == "" {
+		return nil, "", fmt.Errorf("No project given")
+	}
+
+	sm, err := pgantt.NewStateManager(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	phid, err := sm.ProjectPhid(project)
+	if err != nil {
+		return nil, "", err
+	}
+	return sm, phid, nil
+}
+
+func printJson(data interface{}) error {
+	out, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+	return nil
+}
+
+func runServe(fs *flag.FlagSet, opts *pgantt.Opts, args []string) error {
+	fs.Parse(args)
+
+	sm, err := pgantt.NewStateManager(opts)
+	if err != nil {
+		return err
+	}
+
+	sm.StartPolling()
+	pgantt.RunWebServer(sm, opts)
+	return nil
+}
+
+func runExport(fs *flag.FlagSet, opts *pgantt.Opts, args []string) error {
+	project := fs.String("project", "", "name or PHID of the project")
+	format := fs.String("format", "csv", "output format: csv, json or mspdi")
+	output := fs.String("output", "", "output file, the standard output if empty")
+	fs.Parse(args)
+
+	sm, phid, err := openProject(opts, *project)
+	if err != nil {
+		return err
+	}
+
+	data, err := sm.Export(phid, formatName(*format))
+	if err != nil {
+		return err
+	}
+
+	if *output == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return ioutil.WriteFile(*output, data, 0644)
+}
+
+func runValidate(fs *flag.FlagSet, opts *pgantt.Opts, args []string) error {
+	project := fs.String("project", "", "name or PHID of the project")
+	asJson := fs.Bool("json", false, "print the report as JSON")
+	fs.Parse(args)
+
+	sm, phid, err := openProject(opts, *project)
+	if err != nil {
+		return err
+	}
+
+	report := sm.Validate(phid)
+	problems := len(report.Cycles) + len(report.Dangling) + len(report.Violations)
+
+	if *asJson {
+		if err := printJson(report); err != nil {
+			return err
+		}
+	} else {
+		names := make(map[string]string)
+		for _, task := range sm.PlanningData(phid).Data {
+			names[task.Id] = fmt.Sprintf("%q", task.Text)
+		}
+		name := func(id string) string {
+			if n, ok := names[id]; ok {
+				return n
+			}
+			return id
+		}
+
+		for _, cycle := range report.Cycles {
+			chain := []string{}
+			for _, id := range append(cycle, cycle[0]) {
+				chain = append(chain, name(id))
+			}
+			fmt.Printf("Dependency cycle: %s\n", strings.Join(chain, " -> "))
+		}
+		for _, link := range report.Dangling {
+			fmt.Printf("Dangling link: %s -> %s\n", name(link.Source), name(link.Target))
+		}
+		for _, v := range report.Violations {
+			fmt.Printf("Violated link: %s -> %s overlaps by %d working days\n",
+				name(v.Link.Source), name(v.Link.Target), v.Overlap)
+		}
+	}
+
+	if problems != 0 {
+		return fmt.Errorf("Found %d problems in the plan", problems)
+	}
+	return nil
+}
+
+func runSyncCheck(fs *flag.FlagSet, opts *pgantt.Opts, args []string) error {
+	asJson := fs.Bool("json", false, "print the differences as JSON")
+	fs.Parse(args)
+
+	sm, err := pgantt.NewReadOnlyStateManager(opts)
+	if err != nil {
+		return err
+	}
+
+	events, err := sm.SyncCheck()
+	if err != nil {
+		return err
+	}
+
+	if *asJson {
+		if err := printJson(events); err != nil {
+			return err
+		}
+	} else {
+		for _, ev := range events {
+			switch {
+			case ev.Task != nil:
+				fmt.Printf("%s %s: %s %q\n", ev.Project, ev.Type, ev.Task.Id, ev.Task.Text)
+			case ev.Link != nil:
+				fmt.Printf("%s %s: %s\n", ev.Project, ev.Type, ev.Link.Id)
+			}
+		}
+	}
+
+	if len(events) != 0 {
+		return fmt.Errorf("The full sync found %d changes missed by the cached state", len(events))
+	}
+	return nil
+}
+
+func runImport(fs *flag.FlagSet, opts *pgantt.Opts, args []string) error {
+	project := fs.String("project", "", "name or PHID of the project")
+	format := fs.String("format", "", "input format: csv or mspdi, guessed if empty")
+	dryRun := fs.Bool("dry-run", false, "only print the transactions")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("Expected exactly one file to import")
+	}
+
+	data, err := ioutil.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	sm, phid, err := openProject(opts, *project)
+	if err != nil {
+		return err
+	}
+
+	report, err := sm.Import(phid, formatName(*format), data, *dryRun)
+	if report != nil {
+		for _, step := range report.Steps {
+			object := step.Object
+			if object == "" {
+				object = "new task"
+			}
+			fmt.Printf("Task %s (%s):\n", step.Task, object)
+			for _, tr := range step.Transactions {
+				value, _ := json.Marshal(tr.Value)
+				fmt.Printf("  %s: %s\n", tr.Type, value)
+			}
+		}
+	}
+	return err
+}
+
+func runReport(fs *flag.FlagSet, opts *pgantt.Opts, args []string) error {
+	project := fs.String("project", "", "name or PHID of the project")
+	weeks := fs.Int("weeks", 4, "number of weeks to look ahead for milestones")
+	format := fs.String("format", "markdown", "output format: markdown or html")
+	record := fs.Bool("record", false,
+		"remember the plan so that the next report lists the changes, the default with -phriction")
+	phriction := fs.String("phriction", "", "post the report to this Phriction document instead")
+	output := fs.String("output", "", "output file, the standard output if empty")
+	fs.Parse(args)
+
+	// The published reports are the ones the next report should be compared
+	// to, unless told otherwise
+	recordSet := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "record" {
+			recordSet = true
+		}
+	})
+	if *phriction != "" && !recordSet {
+		*record = true
+	}
+
+	if *weeks < 0 {
+		return fmt.Errorf("Invalid number of weeks: %d", *weeks)
+	}
+
+	if *format == "markdown" {
+		*format = pgantt.ReportMarkdown
+	}
+	if *format != pgantt.ReportMarkdown && *format != pgantt.ReportHTML {
+		return fmt.Errorf("Unsupported report format: %q", *format)
+	}
+
+	sm, phid, err := openProject(opts, *project)
+	if err != nil {
+		return err
+	}
+
+	report, err := sm.StatusReport(phid, *weeks)
+	if err != nil {
+		return err
+	}
+
+	// The plan is only recorded once the report has been delivered, so that
+	// the changes of a failed report show up in the next one
+	if *phriction != "" {
+		err = sm.PublishReport(report, *phriction)
+	} else {
+		err = writeReport(report, *format, *output)
+	}
+	if err != nil || !*record {
+		return err
+	}
+	return sm.RecordReportBaseline(phid)
+}
+
+func writeReport(report *pgantt.StatusReport, format, output string) error {
+	data, err := pgantt.FormatStatusReport(report, format)
+	if err != nil {
+		return err
+	}
+
+	if output == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return ioutil.WriteFile(output, data, 0644)
+}
@@ -32,6 +32,7 @@ import (
 func main() {
 	// Commandline
 	logLevel := flag.String("log-level", "Info", "verbosity of the diagnostic information")
+	flag.Usage = printUsage
 	flag.Parse()
 
 	// Logging
@@ -53,6 +54,17 @@ func main() {
 	}
 	log.SetLevel(level)
 
+	cmd := findCommand("serve")
+	args := flag.Args()
+	if len(args) != 0 {
+		cmd = findCommand(args[0])
+		if cmd == nil {
+			printUsage()
+			log.Fatalf("Unknown command: %q", args[0])
+		}
+		args = args[1:]
+	}
+
 	// Configuration
 	usr, err := user.Current()
 	if err != nil {
@@ -61,15 +73,14 @@ func main() {
 
 	configFile := path.Join(usr.HomeDir, ".arcrc")
 	opts := pgantt.NewOpts()
+	opts.PGantt.CacheFile = path.Join(usr.HomeDir, ".cache", "pgantt", "cache.json")
+	opts.PGantt.BaselineDir = path.Join(usr.HomeDir, ".local", "share", "pgantt", "baselines")
 	err = opts.LoadYaml(configFile)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	sm, err := pgantt.NewStateManager(opts)
-	if err != nil {
+	if err := cmd.run(cmd.flags(), opts, args); err != nil {
 		log.Fatal(err)
 	}
-
-	pgantt.RunWebServer(sm, opts)
 }
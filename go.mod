@@ -15,5 +15,6 @@ require (
 	github.com/thought-machine/gonduit v0.2.1-0.20200511073941-6b84c545a505
 	github.com/x-cray/logrus-prefixed-formatter v0.5.2
 	golang.org/x/crypto v0.0.0-20201221181555-eec23a3978ad // indirect
+	golang.org/x/image v0.0.0-20201208152932-35266b937fa6
 	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
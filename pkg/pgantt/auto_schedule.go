@@ -0,0 +1,126 @@
+//------------------------------------------------------------------------------
+// Copyright (C) 2021 Daedalean AG
+//
+// This file is part of PGantt.
+//
+// PGantt is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// PGantt is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with PGantt.  If not, see <https://www.gnu.org/licenses/>.
+//------------------------------------------------------------------------------
+
+package pgantt
+
+import "sort"
+
+// Compute how the tasks depending on the edited task need to move so that none
+// of the links is violated. The tasks are only ever moved later, and only the
+// ones reachable from the edited task through the links are considered, in
+// whichever project they are.
+func propagateSchedule(tasks map[string]*PTask, edited *Task, cal *Calendar) ([]TaskShift, error) {
+	// Only the tasks downstream of the edited one and their direct
+	// predecessors matter, so that a cycle somewhere else in the plan does not
+	// get in the way
+	downstream := map[string]bool{edited.Id: true}
+	queue := []string{edited.Id}
+	for len(queue) != 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if ptask, ok := tasks[id]; ok {
+			for _, link := range ptask.Links {
+				if !downstream[link.Target] {
+					downstream[link.Target] = true
+					queue = append(queue, link.Target)
+				}
+			}
+		}
+	}
+
+	overlay := make(map[string]*PTask)
+	for id, ptask := range tasks {
+		if downstream[id] {
+			overlay[id] = ptask
+			continue
+		}
+		for _, link := range ptask.Links {
+			if downstream[link.Target] {
+				overlay[id] = ptask
+				break
+			}
+		}
+	}
+
+	if ptask, ok := tasks[edited.Id]; ok {
+		overlay[edited.Id] = &PTask{
+			Mtime:  ptask.Mtime,
+			IsLeaf: ptask.IsLeaf,
+			Links:  ptask.Links,
+			Task:   *edited,
+		}
+	}
+
+	g, err := newScheduleGraph(overlay, cal)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := g.nodes[edited.Id]; !ok {
+		return nil, nil
+	}
+
+	reachable := map[string]bool{edited.Id: true}
+	queue = []string{edited.Id}
+	for len(queue) != 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, link := range g.nodes[id].succs {
+			if !reachable[link.Target] {
+				reachable[link.Target] = true
+				queue = append(queue, link.Target)
+			}
+		}
+	}
+
+	// Forward pass that leaves alone everything that is not downstream of the
+	// edited task
+	shifts := []TaskShift{}
+	for _, id := range g.order {
+		node := g.nodes[id]
+		node.es = node.start
+		if id != edited.Id && reachable[id] {
+			for _, link := range node.preds {
+				if es := earliestStartAfter(cal, link, g.nodes[link.Source], node); es > node.es {
+					node.es = es
+				}
+			}
+			if node.es > node.start && node.dur > 0 {
+				node.es = cal.NextWorkday(node.es, node.user)
+			}
+		}
+		node.ef = cal.Finish(node.es, node.dur, node.user)
+
+		if node.es == node.start {
+			continue
+		}
+		shifts = append(shifts, TaskShift{
+			Id:           id,
+			Text:         node.task.Text,
+			OldStartDate: node.task.StartDate,
+			StartDate:    formatDay(node.es),
+		})
+	}
+
+	sort.Slice(shifts, func(i, j int) bool {
+		return shifts[i].Id < shifts[j].Id
+	})
+
+	return shifts, nil
+}
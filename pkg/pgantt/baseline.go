@@ -0,0 +1,198 @@
+//------------------------------------------------------------------------------
+// Copyright (C) 2021 Daedalean AG
+//
+// This file is part of PGantt.
+//
+// PGantt is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// PGantt is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with PGantt.  If not, see <https://www.gnu.org/licenses/>.
+//------------------------------------------------------------------------------
+
+package pgantt
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var baselineNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// The baselines are kept as one JSON file per baseline in a directory per
+// project
+func baselinePath(dir, projPhid, name string) (string, error) {
+	if dir == "" {
+		return "", fmt.Errorf("The baseline directory is not configured")
+	}
+	if !baselineNameRe.MatchString(name) {
+		return "", fmt.Errorf("Invalid baseline name: %q", name)
+	}
+	return filepath.Join(dir, projPhid, name+".json"), nil
+}
+
+func saveBaseline(dir string, baseline *Baseline) error {
+	fileName, err := baselinePath(dir, baseline.Project, baseline.Name)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(fileName); err == nil {
+		return fmt.Errorf("Baseline %q already exists", baseline.Name)
+	}
+
+	data, err := json.Marshal(baseline)
+	if err != nil {
+		return fmt.Errorf("Cannot serialize the baseline: %s", err)
+	}
+	return writeFileAtomic(fileName, data)
+}
+
+func loadBaseline(dir, projPhid, name string) (*Baseline, error) {
+	fileName, err := baselinePath(dir, projPhid, name)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("No such baseline: %q", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read the baseline %q: %s", name, err)
+	}
+
+	baseline := &Baseline{}
+	if err := json.Unmarshal(data, baseline); err != nil {
+		return nil, fmt.Errorf("Malformed baseline %q: %s", name, err)
+	}
+	if baseline.Plan == nil {
+		baseline.Plan = &PlanningData{}
+	}
+	return baseline, nil
+}
+
+// List the baselines of the project, the most recent first
+func listBaselines(dir, projPhid string) ([]BaselineInfo, error) {
+	infos := make([]BaselineInfo, 0)
+	if dir == "" {
+		return infos, nil
+	}
+
+	files, err := ioutil.ReadDir(filepath.Join(dir, projPhid))
+	if os.IsNotExist(err) {
+		return infos, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list the baselines: %s", err)
+	}
+
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		name := strings.TrimSuffix(file.Name(), ".json")
+		baseline, err := loadBaseline(dir, projPhid, name)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, BaselineInfo{baseline.Name, baseline.Created})
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Created != infos[j].Created {
+			return infos[i].Created > infos[j].Created
+		}
+		return infos[i].Name < infos[j].Name
+	})
+	return infos, nil
+}
+
+// Compare the current plan against the baseline. The tasks that kept their
+// start date and duration are left out of the report.
+func compareBaseline(baseline *Baseline, plan *PlanningData, cal *Calendar) *VarianceReport {
+	report := &VarianceReport{
+		Baseline: baseline.Name,
+		Created:  baseline.Created,
+		Tasks:    make([]TaskVariance, 0),
+	}
+
+	old := make(map[string]Task)
+	for _, task := range baseline.Plan.Data {
+		old[task.Id] = task
+	}
+
+	current := make(map[string]bool)
+	for _, task := range plan.Data {
+		if task.External {
+			continue
+		}
+		current[task.Id] = true
+
+		base, ok := old[task.Id]
+		if !ok {
+			report.Tasks = append(report.Tasks, TaskVariance{
+				Id:        task.Id,
+				Text:      task.Text,
+				Status:    VarianceAdded,
+				StartDate: task.StartDate,
+				Duration:  task.Duration,
+			})
+			continue
+		}
+
+		if base.StartDate == task.StartDate && base.Duration == task.Duration {
+			continue
+		}
+
+		variance := TaskVariance{
+			Id:                task.Id,
+			Text:              task.Text,
+			Status:            VarianceChanged,
+			BaselineStartDate: base.StartDate,
+			StartDate:         task.StartDate,
+			BaselineDuration:  base.Duration,
+			Duration:          task.Duration,
+			DurationChange:    task.Duration - base.Duration,
+		}
+
+		from, err1 := parseDay(base.StartDate)
+		to, err2 := parseDay(task.StartDate)
+		if err1 == nil && err2 == nil {
+			variance.StartSlip = cal.Workdays(from, to, task.Owner)
+		}
+
+		report.Tasks = append(report.Tasks, variance)
+	}
+
+	for _, task := range baseline.Plan.Data {
+		if current[task.Id] {
+			continue
+		}
+		report.Tasks = append(report.Tasks, TaskVariance{
+			Id:                task.Id,
+			Text:              task.Text,
+			Status:            VarianceRemoved,
+			BaselineStartDate: task.StartDate,
+			BaselineDuration:  task.Duration,
+		})
+	}
+
+	sort.Slice(report.Tasks, func(i, j int) bool {
+		return report.Tasks[i].Id < report.Tasks[j].Id
+	})
+	return report
+}
@@ -0,0 +1,118 @@
+//------------------------------------------------------------------------------
+// Copyright (C) 2021 Daedalean AG
+//
+// This file is part of PGantt.
+//
+// PGantt is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// PGantt is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with PGantt.  If not, see <https://www.gnu.org/licenses/>.
+//------------------------------------------------------------------------------
+
+package pgantt
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompareBaseline(t *testing.T) {
+	cal := testHolidayCalendar(t)
+
+	baseline := &Baseline{
+		Name:    "march",
+		Created: "2021-02-26",
+		Plan: &PlanningData{Data: []Task{
+			{Id: "A", Text: "A", StartDate: "2021-03-01", Duration: 3},
+			{Id: "B", Text: "B", StartDate: "2021-03-04", Duration: 2},
+			{Id: "C", Text: "C", StartDate: "2021-03-08", Duration: 1},
+			{Id: "D", Text: "D", StartDate: "2021-03-01", Duration: 2},
+			{Id: "E", Text: "E", StartDate: "2021-03-01", Duration: 2, Owner: "PHID-USER-B"},
+			{Id: "G", Text: "G", StartDate: "2021-03-01", Duration: 2},
+		}},
+	}
+	plan := &PlanningData{Data: []Task{
+		{Id: "A", Text: "A", StartDate: "2021-03-11", Duration: 3},
+		{Id: "B", Text: "B", StartDate: "2021-03-02", Duration: 4},
+		{Id: "D", Text: "D", StartDate: "2021-03-01", Duration: 2},
+		{Id: "E", Text: "E", StartDate: "2021-03-05", Duration: 2, Owner: "PHID-USER-B"},
+		{Id: "F", Text: "F", StartDate: "2021-03-08", Duration: 1},
+		{Id: "G", Text: "G", Duration: 2, Unscheduled: true},
+		{Id: "X", Text: "X", StartDate: "2021-03-01", Duration: 1, External: true},
+	}}
+
+	expected := []TaskVariance{
+		// The slip skips the weekend and the holiday
+		{Id: "A", Text: "A", Status: VarianceChanged, BaselineStartDate: "2021-03-01", StartDate: "2021-03-11",
+			StartSlip: 7, BaselineDuration: 3, Duration: 3},
+		// Earlier and longer
+		{Id: "B", Text: "B", Status: VarianceChanged, BaselineStartDate: "2021-03-04", StartDate: "2021-03-02",
+			StartSlip: -2, BaselineDuration: 2, Duration: 4, DurationChange: 2},
+		{Id: "C", Text: "C", Status: VarianceRemoved, BaselineStartDate: "2021-03-08", BaselineDuration: 1},
+		// The slip skips the vacation of the owner
+		{Id: "E", Text: "E", Status: VarianceChanged, BaselineStartDate: "2021-03-01", StartDate: "2021-03-05",
+			StartSlip: 3, BaselineDuration: 2, Duration: 2},
+		{Id: "F", Text: "F", Status: VarianceAdded, StartDate: "2021-03-08", Duration: 1},
+		// No longer scheduled, there is nothing to measure the slip from
+		{Id: "G", Text: "G", Status: VarianceChanged, BaselineStartDate: "2021-03-01",
+			BaselineDuration: 2, Duration: 2},
+	}
+
+	report := compareBaseline(baseline, plan, cal)
+	if report.Baseline != "march" || report.Created != "2021-02-26" {
+		t.Errorf("Expected the report against march of 2021-02-26, got %s of %s", report.Baseline, report.Created)
+	}
+	if !reflect.DeepEqual(report.Tasks, expected) {
+		t.Errorf("Unexpected variance:")
+		for _, task := range report.Tasks {
+			t.Errorf("%+v", task)
+		}
+	}
+}
+
+func TestListBaselines(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, baseline := range []*Baseline{
+		{Name: "january", Project: "P", Created: "2021-01-04"},
+		{Name: "march", Project: "P", Created: "2021-03-01"},
+		{Name: "february", Project: "P", Created: "2021-02-01"},
+		{Name: "other", Project: "Q", Created: "2021-03-01"},
+	} {
+		if err := saveBaseline(dir, baseline); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := saveBaseline(dir, &Baseline{Name: "march", Project: "P"}); err == nil {
+		t.Errorf("An existing baseline was overwritten")
+	}
+	if err := saveBaseline(dir, &Baseline{Name: "../march", Project: "P"}); err == nil {
+		t.Errorf("A baseline with an invalid name was saved")
+	}
+
+	infos, err := listBaselines(dir, "P")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []BaselineInfo{{"march", "2021-03-01"}, {"february", "2021-02-01"}, {"january", "2021-01-04"}}
+	if !reflect.DeepEqual(infos, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, infos)
+	}
+
+	baseline, err := loadBaseline(dir, "P", "february")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if baseline.Created != "2021-02-01" || baseline.Plan == nil {
+		t.Errorf("Unexpected baseline %+v", baseline)
+	}
+}
@@ -0,0 +1,129 @@
+//------------------------------------------------------------------------------
+// Copyright (C) 2021 Daedalean AG
+//
+// This file is part of PGantt.
+//
+// PGantt is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// PGantt is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with PGantt.  If not, see <https://www.gnu.org/licenses/>.
+//------------------------------------------------------------------------------
+
+package pgantt
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Bump whenever the layout of the cached data changes, so that the older caches
+// are discarded. Version 6 caches carry the task versions and at most one link
+// between two tasks.
+const cacheVersion = 6
+
+type StateCache struct {
+	Version  int                          `json:"version"`
+	Host     string                       `json:"host"`
+	Names    []string                     `json:"names"`
+	Projects []Project                    `json:"projects"`
+	Tasks    map[string]map[string]*PTask `json:"tasks"`
+	Starts   map[string]int               `json:"starts"` // Start dates the notifier measures the slips from
+}
+
+// Load the cache and check that it was made for the same host and the same set
+// of projects. Returns nil if the cache is missing or stale.
+func LoadCache(fileName, host string, names []string) *StateCache {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warningf("Unable to read the cache file %s: %s", fileName, err)
+		}
+		return nil
+	}
+
+	cache := &StateCache{}
+	if err := json.Unmarshal(data, cache); err != nil {
+		log.Warningf("Malformed cache file %s: %s", fileName, err)
+		return nil
+	}
+
+	if cache.Version != cacheVersion {
+		log.Infof("Discarding the cache: version %d, expected %d", cache.Version, cacheVersion)
+		return nil
+	}
+
+	if cache.Host != host || !reflect.DeepEqual(cache.Names, names) {
+		log.Infof("Discarding the cache: made for a different host or project list")
+		return nil
+	}
+
+	if cache.Tasks == nil {
+		cache.Tasks = make(map[string]map[string]*PTask)
+	}
+
+	if cache.Starts == nil {
+		cache.Starts = make(map[string]int)
+	}
+
+	for _, proj := range cache.Projects {
+		if cache.Tasks[proj.Phid] == nil {
+			cache.Tasks[proj.Phid] = make(map[string]*PTask)
+		}
+	}
+
+	return cache
+}
+
+func (c *StateCache) Save(fileName string) error {
+	c.Version = cacheVersion
+	data, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("Cannot serialize the cache: %s", err)
+	}
+	return writeFileAtomic(fileName, data)
+}
+
+// Write the file atomically, so that a crash never leaves a truncated file
+// behind
+func writeFileAtomic(fileName string, data []byte) error {
+	dir := filepath.Dir(fileName)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("Cannot create the directory %s: %s", dir, err)
+	}
+
+	tmp, err := ioutil.TempFile(dir, filepath.Base(fileName)+".*")
+	if err != nil {
+		return fmt.Errorf("Cannot create %s: %s", fileName, err)
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("Cannot write %s: %s", fileName, err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("Cannot write %s: %s", fileName, err)
+	}
+
+	if err := os.Rename(tmp.Name(), fileName); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("Cannot replace %s: %s", fileName, err)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+//------------------------------------------------------------------------------
+// Copyright (C) 2021 Daedalean AG
+//
+// This file is part of PGantt.
+//
+// PGantt is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// PGantt is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with PGantt.  If not, see <https://www.gnu.org/licenses/>.
+//------------------------------------------------------------------------------
+
+package pgantt
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadCache(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{"Foo"}
+
+	writeCache := func(version int) string {
+		fileName := filepath.Join(dir, fmt.Sprintf("cache-%d.json", version))
+		data := fmt.Sprintf(`{"version": %d, "host": "https://phab", "names": ["Foo"],
+			"projects": [{"name": "Foo", "phid": "PHID-PROJ-1"}],
+			"tasks": {"PHID-PROJ-1": {"PHID-TASK-1": {"Mtime": 1234, "Task": {"id": "PHID-TASK-1", "version": 1234}}}}}`,
+			version)
+		if err := ioutil.WriteFile(fileName, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return fileName
+	}
+
+	if cache := LoadCache(writeCache(cacheVersion-1), "https://phab", names); cache != nil {
+		t.Errorf("A cache of an older version was not discarded")
+	}
+
+	cache := LoadCache(writeCache(cacheVersion), "https://phab", names)
+	if cache == nil {
+		t.Fatalf("The cache was discarded")
+	}
+	if version := cache.Tasks["PHID-PROJ-1"]["PHID-TASK-1"].Task.Version; version != 1234 {
+		t.Errorf("Expected the task version to be 1234, got %d", version)
+	}
+
+	if cache := LoadCache(writeCache(cacheVersion), "https://other", names); cache != nil {
+		t.Errorf("A cache of a different host was not discarded")
+	}
+}
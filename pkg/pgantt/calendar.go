@@ -0,0 +1,409 @@
+//------------------------------------------------------------------------------
+// Copyright (C) 2021 Daedalean AG
+//
+// This file is part of PGantt.
+//
+// PGantt is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// PGantt is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with PGantt.  If not, see <https://www.gnu.org/licenses/>.
+//------------------------------------------------------------------------------
+
+package pgantt
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const dayFormat = "2006-01-02"
+
+// Convert a date string to the number of days since the Unix epoch
+func parseDay(date string) (int, error) {
+	tm, err := time.Parse(dayFormat, date)
+	if err != nil {
+		return 0, err
+	}
+	return int(tm.Unix() / 86400), nil
+}
+
+func formatDay(day int) string {
+	return time.Unix(int64(day)*86400, 0).UTC().Format(dayFormat)
+}
+
+func dayTime(day int) time.Time {
+	return time.Unix(int64(day)*86400, 0).UTC()
+}
+
+// Working calendar deciding which days count towards the task durations. The
+// days off are either common to everyone (weekends and public holidays) or
+// personal (vacations). A nil calendar treats every day as a working day.
+type Calendar struct {
+	weekend   [7]bool
+	holidays  map[int]bool
+	vacations map[string]map[int]bool
+}
+
+func NewCalendar(opts *CalendarOpts, users []User) (*Calendar, error) {
+	c := &Calendar{
+		holidays:  make(map[int]bool),
+		vacations: make(map[string]map[int]bool),
+	}
+
+	for _, wd := range opts.Weekend {
+		if wd < 0 || wd > 6 {
+			return nil, fmt.Errorf("Invalid day of the week: %d", wd)
+		}
+		c.weekend[wd] = true
+	}
+
+	working := false
+	for _, off := range c.weekend {
+		working = working || !off
+	}
+	if !working {
+		return nil, fmt.Errorf("The calendar needs at least one working day a week")
+	}
+
+	if err := addDays(c.holidays, opts.Holidays); err != nil {
+		return nil, fmt.Errorf("Malformed holidays: %s", err)
+	}
+
+	for _, fileName := range opts.HolidayFiles {
+		if err := addIcsDays(c.holidays, fileName); err != nil {
+			return nil, err
+		}
+	}
+
+	userPhids := make(map[string]string)
+	for _, user := range users {
+		userPhids[user.Name] = user.Phid
+	}
+
+	userDays := func(name string) map[int]bool {
+		phid, ok := userPhids[name]
+		if !ok {
+			log.Warningf("Ignoring the vacations of unknown user %q", name)
+			return nil
+		}
+		if c.vacations[phid] == nil {
+			c.vacations[phid] = make(map[int]bool)
+		}
+		return c.vacations[phid]
+	}
+
+	for name, days := range opts.Vacations {
+		if vacations := userDays(name); vacations != nil {
+			if err := addDays(vacations, days); err != nil {
+				return nil, fmt.Errorf("Malformed vacations of %q: %s", name, err)
+			}
+		}
+	}
+
+	for name, fileName := range opts.VacationFiles {
+		if vacations := userDays(name); vacations != nil {
+			if err := addIcsDays(vacations, fileName); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return c, nil
+}
+
+// Add days given either as single dates or as date/date ranges, both ends
+// inclusive
+func addDays(days map[int]bool, specs []string) error {
+	for _, spec := range specs {
+		fragments := strings.Split(spec, "/")
+		if len(fragments) > 2 {
+			return fmt.Errorf("Invalid range: %q", spec)
+		}
+
+		first, err := parseDay(strings.TrimSpace(fragments[0]))
+		if err != nil {
+			return err
+		}
+
+		last := first
+		if len(fragments) == 2 {
+			if last, err = parseDay(strings.TrimSpace(fragments[1])); err != nil {
+				return err
+			}
+		}
+
+		for day := first; day <= last; day++ {
+			days[day] = true
+		}
+	}
+	return nil
+}
+
+// Add the days covered by the events of an iCalendar file
+func addIcsDays(days map[int]bool, fileName string) error {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return fmt.Errorf("Unable to read the calendar file %s: %s", fileName, err)
+	}
+	defer file.Close()
+
+	// Unfold the continuation lines first
+	lines := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) != 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("Unable to read the calendar file %s: %s", fileName, err)
+	}
+
+	parseIcsDay := func(line string) (int, error) {
+		value := line[strings.Index(line, ":")+1:]
+		if len(value) < 8 {
+			return 0, fmt.Errorf("Malformed date: %q", value)
+		}
+		tm, err := time.Parse("20060102", value[:8])
+		if err != nil {
+			return 0, err
+		}
+		return int(tm.Unix() / 86400), nil
+	}
+
+	inEvent := false
+	start, end := 0, 0
+	hasStart, hasEnd := false, false
+	rule := ""
+	for _, line := range lines {
+		name := strings.ToUpper(line)
+		if i := strings.IndexAny(name, ";:"); i != -1 {
+			name = name[:i]
+		}
+
+		switch {
+		case line == "BEGIN:VEVENT":
+			inEvent = true
+			hasStart, hasEnd = false, false
+			rule = ""
+		case line == "END:VEVENT":
+			inEvent = false
+			if !hasStart {
+				continue
+			}
+			// The end date is exclusive
+			if !hasEnd || end <= start {
+				end = start + 1
+			}
+			starts, err := yearlyRecurrences(start, rule)
+			if err != nil {
+				log.Warningf("Using only the first occurrence of an event in %s: %s", fileName, err)
+				starts = []int{start}
+			}
+			for _, first := range starts {
+				for day := first; day < first+end-start; day++ {
+					days[day] = true
+				}
+			}
+		case inEvent && name == "DTSTART":
+			if start, err = parseIcsDay(line); err != nil {
+				return fmt.Errorf("Malformed event in %s: %s", fileName, err)
+			}
+			hasStart = true
+		case inEvent && name == "DTEND":
+			if end, err = parseIcsDay(line); err != nil {
+				return fmt.Errorf("Malformed event in %s: %s", fileName, err)
+			}
+			hasEnd = true
+		case inEvent && name == "RRULE":
+			rule = line[strings.Index(line, ":")+1:]
+		}
+	}
+	return nil
+}
+
+// How many years ahead the yearly events without an end are repeated
+const recurrenceHorizon = 10
+
+// The first days of all the occurrences of an event repeating every year on
+// the same date, like most public holidays do. The other rules are not
+// supported.
+func yearlyRecurrences(start int, rule string) ([]int, error) {
+	if rule == "" {
+		return []int{start}, nil
+	}
+
+	first := dayTime(start)
+	interval, count := 1, 0
+	until := time.Time{}
+	yearly := false
+	for _, part := range strings.Split(rule, ";") {
+		kv := strings.SplitN(strings.ToUpper(part), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("Malformed recurrence rule: %q", rule)
+		}
+
+		var err error
+		switch kv[0] {
+		case "FREQ":
+			yearly = kv[1] == "YEARLY"
+		case "INTERVAL":
+			interval, err = strconv.Atoi(kv[1])
+			if err == nil && interval < 1 {
+				err = fmt.Errorf("Invalid interval: %d", interval)
+			}
+		case "COUNT":
+			count, err = strconv.Atoi(kv[1])
+		case "UNTIL":
+			if len(kv[1]) < 8 {
+				err = fmt.Errorf("Malformed date: %q", kv[1])
+			} else {
+				until, err = time.Parse("20060102", kv[1][:8])
+			}
+		// Redundant when they name the date of the first occurrence
+		case "BYMONTH":
+			if kv[1] != strconv.Itoa(int(first.Month())) {
+				yearly = false
+			}
+		case "BYMONTHDAY":
+			if kv[1] != strconv.Itoa(first.Day()) {
+				yearly = false
+			}
+		default:
+			yearly = false
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Malformed recurrence rule %q: %s", rule, err)
+		}
+	}
+
+	if !yearly {
+		return nil, fmt.Errorf("Unsupported recurrence rule: %q", rule)
+	}
+
+	if count == 0 && until.IsZero() {
+		until = time.Date(time.Now().Year()+recurrenceHorizon, 12, 31, 0, 0, 0, 0, time.UTC)
+	}
+
+	starts := []int{}
+	for year := 0; count == 0 || len(starts) < count; year += interval {
+		tm := first.AddDate(year, 0, 0)
+		if !until.IsZero() && tm.After(until) {
+			break
+		}
+		// An event on the 29th of February only happens in leap years
+		if tm.Day() != first.Day() {
+			continue
+		}
+		starts = append(starts, int(tm.Unix()/86400))
+	}
+	return starts, nil
+}
+
+// The weekend days and the public holidays, sorted
+func (c *Calendar) WorkCalendar() *WorkCalendar {
+	wc := &WorkCalendar{Weekend: []int{}, Holidays: []string{}}
+	for wd, off := range c.weekend {
+		if off {
+			wc.Weekend = append(wc.Weekend, wd)
+		}
+	}
+
+	days := make([]int, 0, len(c.holidays))
+	for day := range c.holidays {
+		days = append(days, day)
+	}
+	sort.Ints(days)
+	for _, day := range days {
+		wc.Holidays = append(wc.Holidays, formatDay(day))
+	}
+	return wc
+}
+
+func (c *Calendar) IsWorkday(day int, user string) bool {
+	if c == nil {
+		return true
+	}
+	if c.weekend[dayTime(day).Weekday()] || c.holidays[day] {
+		return false
+	}
+	return !c.vacations[user][day]
+}
+
+// The first working day not earlier than the given day
+func (c *Calendar) NextWorkday(day int, user string) int {
+	for !c.IsWorkday(day, user) {
+		day++
+	}
+	return day
+}
+
+// The day after the last working day of a task lasting dur working days and
+// starting at the given day
+func (c *Calendar) Finish(start, dur int, user string) int {
+	day := start
+	for dur > 0 {
+		if c.IsWorkday(day, user) {
+			dur--
+		}
+		day++
+	}
+	return day
+}
+
+// The first day of a task lasting dur working days and finishing right before
+// the given day
+func (c *Calendar) Start(finish, dur int, user string) int {
+	day := finish
+	for dur > 0 {
+		day--
+		if c.IsWorkday(day, user) {
+			dur--
+		}
+	}
+	return day
+}
+
+// Move the day by the given number of working days, forwards if positive and
+// backwards if negative
+func (c *Calendar) Shift(day, n int, user string) int {
+	if n < 0 {
+		return c.Start(day, -n, user)
+	}
+	return c.Finish(day, n, user)
+}
+
+// Number of working days in [from, to), negative if to precedes from
+func (c *Calendar) Workdays(from, to int, user string) int {
+	sign := 1
+	if to < from {
+		from, to = to, from
+		sign = -1
+	}
+
+	count := 0
+	for day := from; day < to; day++ {
+		if c.IsWorkday(day, user) {
+			count++
+		}
+	}
+	return sign * count
+}
@@ -0,0 +1,212 @@
+//------------------------------------------------------------------------------
+// Copyright (C) 2021 Daedalean AG
+//
+// This file is part of PGantt.
+//
+// PGantt is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// PGantt is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with PGantt.  If not, see <https://www.gnu.org/licenses/>.
+//------------------------------------------------------------------------------
+
+package pgantt
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Weekends off, a holiday on Wednesday, 2021-03-10, and Bob off on Wednesday,
+// 2021-03-03. The 1st of March 2021 was a Monday.
+func testHolidayCalendar(t *testing.T) *Calendar {
+	cal, err := NewCalendar(&CalendarOpts{
+		Weekend:   []int{0, 6},
+		Holidays:  []string{"2021-03-10"},
+		Vacations: map[string][]string{"bob": {"2021-03-03"}},
+	}, []User{{Name: "bob", Phid: "PHID-USER-B"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cal
+}
+
+func TestCalendarFinish(t *testing.T) {
+	cal := testHolidayCalendar(t)
+
+	tests := []struct {
+		name   string
+		start  string
+		dur    int
+		user   string
+		finish string
+	}{
+		{"within a week", "2021-03-01", 3, "", "2021-03-04"},
+		{"over a weekend", "2021-03-04", 3, "", "2021-03-09"},
+		{"over a holiday", "2021-03-08", 3, "", "2021-03-12"},
+		{"starting on a weekend", "2021-03-06", 1, "", "2021-03-09"},
+		{"over a vacation", "2021-03-01", 3, "PHID-USER-B", "2021-03-05"},
+		{"other people's vacation", "2021-03-01", 3, "PHID-USER-A", "2021-03-04"},
+		{"no duration", "2021-03-01", 0, "", "2021-03-01"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			start := testDay(t, test.start)
+			finish := cal.Finish(start, test.dur, test.user)
+			if formatDay(finish) != test.finish {
+				t.Errorf("Expected %s, got %s", test.finish, formatDay(finish))
+			}
+			if test.dur == 0 {
+				return
+			}
+			// Going back from the finish lands on the first working day
+			if back := cal.Start(finish, test.dur, test.user); back != cal.NextWorkday(start, test.user) {
+				t.Errorf("Expected to go back to %s, got %s",
+					formatDay(cal.NextWorkday(start, test.user)), formatDay(back))
+			}
+		})
+	}
+}
+
+func TestCalendarWorkdays(t *testing.T) {
+	cal := testHolidayCalendar(t)
+
+	tests := []struct {
+		name     string
+		from     string
+		to       string
+		user     string
+		workdays int
+	}{
+		{"a full week", "2021-03-01", "2021-03-08", "", 5},
+		{"a week with a holiday", "2021-03-08", "2021-03-15", "", 4},
+		{"backwards", "2021-03-15", "2021-03-08", "", -4},
+		{"a weekend", "2021-03-06", "2021-03-08", "", 0},
+		{"a week with a vacation", "2021-03-01", "2021-03-08", "PHID-USER-B", 4},
+		{"an empty range", "2021-03-01", "2021-03-01", "", 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			from, to := testDay(t, test.from), testDay(t, test.to)
+			if workdays := cal.Workdays(from, to, test.user); workdays != test.workdays {
+				t.Errorf("Expected %d working days, got %d", test.workdays, workdays)
+			}
+		})
+	}
+}
+
+func TestCalendarShift(t *testing.T) {
+	cal := testHolidayCalendar(t)
+
+	tests := []struct {
+		name    string
+		day     string
+		n       int
+		user    string
+		shifted string
+	}{
+		{"forwards over a weekend", "2021-03-04", 3, "", "2021-03-09"},
+		{"backwards over a weekend", "2021-03-09", -3, "", "2021-03-04"},
+		{"backwards over a holiday", "2021-03-12", -3, "", "2021-03-08"},
+		{"backwards over a vacation", "2021-03-05", -3, "PHID-USER-B", "2021-03-01"},
+		{"not at all", "2021-03-06", 0, "", "2021-03-06"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			shifted := cal.Shift(testDay(t, test.day), test.n, test.user)
+			if formatDay(shifted) != test.shifted {
+				t.Errorf("Expected %s, got %s", test.shifted, formatDay(shifted))
+			}
+		})
+	}
+}
+
+func TestCalendarNextWorkday(t *testing.T) {
+	cal := testHolidayCalendar(t)
+
+	tests := []struct {
+		day  string
+		user string
+		next string
+	}{
+		{"2021-03-01", "", "2021-03-01"},
+		{"2021-03-06", "", "2021-03-08"},
+		{"2021-03-10", "", "2021-03-11"},
+		{"2021-03-03", "PHID-USER-B", "2021-03-04"},
+		{"2021-03-03", "", "2021-03-03"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.day+test.user, func(t *testing.T) {
+			if next := cal.NextWorkday(testDay(t, test.day), test.user); formatDay(next) != test.next {
+				t.Errorf("Expected %s, got %s", test.next, formatDay(next))
+			}
+		})
+	}
+}
+
+func TestCalendarHolidayFile(t *testing.T) {
+	events := []string{
+		// Two days off every year
+		"DTSTART;VALUE=DATE:20201225", "DTEND;VALUE=DATE:20201227", "RRULE:FREQ=YEARLY",
+		"END:VEVENT", "BEGIN:VEVENT",
+		"DTSTART;VALUE=DATE:20210101", "RRULE:FREQ=YEARLY;COUNT=2",
+		"END:VEVENT", "BEGIN:VEVENT",
+		// Every other year, with the rule folded
+		"DTSTART;VALUE=DATE:20210501", "RRULE:FREQ=YEARLY;INTERVAL=2;UNT", " IL=20250101T000000Z",
+		"END:VEVENT", "BEGIN:VEVENT",
+		"DTSTART;VALUE=DATE:20200229", "RRULE:FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=29;COUNT=2",
+		"END:VEVENT", "BEGIN:VEVENT",
+		// Only the first occurrence is used
+		"DTSTART;VALUE=DATE:20210301", "RRULE:FREQ=WEEKLY",
+	}
+	data := "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\n" + strings.Join(events, "\r\n") +
+		"\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+	fileName := filepath.Join(t.TempDir(), "holidays.ics")
+	if err := ioutil.WriteFile(fileName, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cal, err := NewCalendar(&CalendarOpts{HolidayFiles: []string{fileName}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	holidays := []string{
+		"2020-12-25", "2020-12-26", "2021-12-25", "2021-12-26", "2025-12-25", "2025-12-26",
+		"2021-01-01", "2022-01-01",
+		"2021-05-01", "2023-05-01",
+		"2020-02-29", "2024-02-29",
+		"2021-03-01",
+	}
+	for _, date := range holidays {
+		if cal.IsWorkday(testDay(t, date), "") {
+			t.Errorf("Expected %s to be a holiday", date)
+		}
+	}
+
+	workdays := []string{
+		"2020-12-27", "2021-12-24",
+		"2023-01-01",
+		"2022-05-01", "2025-05-01",
+		"2021-02-28", "2028-02-29",
+		"2021-03-08",
+	}
+	for _, date := range workdays {
+		if !cal.IsWorkday(testDay(t, date), "") {
+			t.Errorf("Expected %s to be a working day", date)
+		}
+	}
+}
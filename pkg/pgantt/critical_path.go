@@ -0,0 +1,307 @@
+//------------------------------------------------------------------------------
+// Copyright (C) 2021 Daedalean AG
+//
+// This file is part of PGantt.
+//
+// PGantt is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// PGantt is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with PGantt.  If not, see <https://www.gnu.org/licenses/>.
+//------------------------------------------------------------------------------
+
+package pgantt
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type scheduleNode struct {
+	task   *Task
+	user   string
+	start  int
+	dur    int
+	es, ef int
+	ls, lf int
+	driver string
+	preds  []*Link
+	succs  []*Link
+}
+
+// Only the tasks that have a start date and are not summary tasks take part in
+// the scheduling, nil is returned for all the others. The durations are
+// counted in the working days of the task's owner.
+func newScheduleNode(task *Task, cal *Calendar) (*scheduleNode, error) {
+	if task.Unscheduled || task.StartDate == "" || task.Type == "project" {
+		return nil, nil
+	}
+	start, err := parseDay(task.StartDate)
+	if err != nil {
+		return nil, fmt.Errorf("Malformed start date of task %q: %s", task.Id, err)
+	}
+	node := &scheduleNode{task: task, user: task.Owner, start: start, dur: task.Duration}
+	if task.Type == "milestone" {
+		node.dur = 0
+	}
+	node.es = node.start
+	node.ef = cal.Finish(node.start, node.dur, node.user)
+	return node, nil
+}
+
+// Scheduled tasks of a project together with the links between them, sorted
+// topologically
+type scheduleGraph struct {
+	cal   *Calendar
+	nodes map[string]*scheduleNode
+	order []string
+}
+
+// Links touching the tasks that are not scheduled are ignored
+func newScheduleGraph(tasks map[string]*PTask, cal *Calendar) (*scheduleGraph, error) {
+	g := &scheduleGraph{cal: cal, nodes: make(map[string]*scheduleNode)}
+
+	for id, ptask := range tasks {
+		node, err := newScheduleNode(&ptask.Task, cal)
+		if err != nil {
+			return nil, err
+		}
+		if node != nil {
+			g.nodes[id] = node
+		}
+	}
+
+	for id := range g.nodes {
+		for _, link := range tasks[id].Links {
+			target, ok := g.nodes[link.Target]
+			if !ok {
+				continue
+			}
+			g.nodes[id].succs = append(g.nodes[id].succs, link)
+			target.preds = append(target.preds, link)
+		}
+	}
+
+	ids := make([]string, 0, len(g.nodes))
+	for id := range g.nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		node := g.nodes[id]
+		sort.Slice(node.preds, func(i, j int) bool { return node.preds[i].Id < node.preds[j].Id })
+		sort.Slice(node.succs, func(i, j int) bool { return node.succs[i].Id < node.succs[j].Id })
+	}
+
+	// Kahn's algorithm, the ready queue is kept sorted to make the order stable
+	inDegree := make(map[string]int)
+	for _, id := range ids {
+		inDegree[id] = len(g.nodes[id].preds)
+	}
+
+	ready := []string{}
+	for _, id := range ids {
+		if inDegree[id] == 0 {
+			ready = append(ready, id)
+		}
+	}
+
+	for len(ready) != 0 {
+		id := ready[0]
+		ready = ready[1:]
+		g.order = append(g.order, id)
+		added := false
+		for _, link := range g.nodes[id].succs {
+			inDegree[link.Target]--
+			if inDegree[link.Target] == 0 {
+				ready = append(ready, link.Target)
+				added = true
+			}
+		}
+		if added {
+			sort.Strings(ready)
+		}
+	}
+
+	if len(g.order) != len(g.nodes) {
+		blocked := []string{}
+		for _, id := range ids {
+			if inDegree[id] != 0 {
+				blocked = append(blocked, id)
+			}
+		}
+		return nil, fmt.Errorf("Dependency cycle among tasks: %s", strings.Join(blocked, ", "))
+	}
+
+	return g, nil
+}
+
+// The earliest day the successor may start given the earliest dates of the
+// predecessor. The lag is counted in the working days of the successor.
+func earliestStartAfter(cal *Calendar, link *Link, pred, succ *scheduleNode) int {
+	switch link.Type {
+	case LinkStartToStart:
+		return cal.Shift(pred.es, link.Lag, succ.user)
+	case LinkFinishToFinish:
+		return cal.Start(cal.Shift(pred.ef, link.Lag, succ.user), succ.dur, succ.user)
+	case LinkStartToFinish:
+		return cal.Start(cal.Shift(pred.es, link.Lag, succ.user), succ.dur, succ.user)
+	}
+	return cal.Shift(pred.ef, link.Lag, succ.user)
+}
+
+// The latest day the predecessor may finish given the latest dates of the
+// successor
+func latestFinishBefore(cal *Calendar, link *Link, pred, succ *scheduleNode) int {
+	switch link.Type {
+	case LinkStartToStart:
+		return cal.Finish(cal.Shift(succ.ls, -link.Lag, succ.user), pred.dur, pred.user)
+	case LinkFinishToFinish:
+		return cal.Shift(succ.lf, -link.Lag, succ.user)
+	case LinkStartToFinish:
+		return cal.Finish(cal.Shift(succ.lf, -link.Lag, succ.user), pred.dur, pred.user)
+	}
+	return cal.Shift(succ.ls, -link.Lag, succ.user)
+}
+
+// Compute the earliest and latest dates of every node. The scheduled start
+// date of a task is treated as "start no earlier than" constraint.
+func (g *scheduleGraph) analyze() (start, finish int) {
+	first := true
+	for _, id := range g.order {
+		node := g.nodes[id]
+		node.es = node.start
+		node.driver = ""
+		starts := make([]int, len(node.preds))
+		for i, link := range node.preds {
+			starts[i] = earliestStartAfter(g.cal, link, g.nodes[link.Source], node)
+			if node.dur > 0 {
+				starts[i] = g.cal.NextWorkday(starts[i], node.user)
+			}
+			if starts[i] > node.es {
+				node.es = starts[i]
+			}
+		}
+
+		// The driving predecessor is the one leaving no free float, which
+		// includes the usual case of a task placed right where its
+		// predecessor allows it to start
+		for i, link := range node.preds {
+			if starts[i] >= node.start && starts[i] == node.es {
+				node.driver = link.Source
+				break
+			}
+		}
+		node.ef = g.cal.Finish(node.es, node.dur, node.user)
+
+		if first || node.es < start {
+			start = node.es
+		}
+		if first || node.ef > finish {
+			finish = node.ef
+		}
+		first = false
+	}
+
+	for i := len(g.order) - 1; i >= 0; i-- {
+		node := g.nodes[g.order[i]]
+		node.lf = finish
+		for _, link := range node.succs {
+			lf := latestFinishBefore(g.cal, link, node, g.nodes[link.Target])
+			if lf < node.lf {
+				node.lf = lf
+			}
+		}
+		node.ls = g.cal.Start(node.lf, node.dur, node.user)
+	}
+	return
+}
+
+// The tasks together with all the tasks they depend on, directly or not,
+// wherever they come from
+func withPredecessors(all, tasks map[string]*PTask) map[string]*PTask {
+	preds := make(map[string][]string)
+	for id, ptask := range all {
+		for _, link := range ptask.Links {
+			preds[link.Target] = append(preds[link.Target], id)
+		}
+	}
+
+	scope := make(map[string]*PTask, len(tasks))
+	queue := []string{}
+	for id, ptask := range tasks {
+		scope[id] = ptask
+		queue = append(queue, id)
+	}
+
+	for len(queue) != 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, source := range preds[id] {
+			if _, ok := scope[source]; !ok {
+				scope[source] = all[source]
+				queue = append(queue, source)
+			}
+		}
+	}
+	return scope
+}
+
+func criticalPath(tasks map[string]*PTask, cal *Calendar) (*CriticalPathData, error) {
+	g, err := newScheduleGraph(tasks, cal)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &CriticalPathData{}
+	data.Tasks = make([]CriticalPathTask, 0, len(g.order))
+	data.Path = make([]string, 0)
+
+	if len(g.order) == 0 {
+		return data, nil
+	}
+
+	start, finish := g.analyze()
+	data.Start = formatDay(start)
+	data.Finish = formatDay(finish)
+
+	for _, id := range g.order {
+		node := g.nodes[id]
+		cpTask := CriticalPathTask{
+			Id:             id,
+			EarliestStart:  formatDay(node.es),
+			EarliestFinish: formatDay(node.ef),
+			LatestStart:    formatDay(node.ls),
+			LatestFinish:   formatDay(node.lf),
+			TotalFloat:     cal.Workdays(node.es, node.ls, node.user),
+			Critical:       node.ls <= node.es,
+			Driver:         node.driver,
+		}
+		data.Tasks = append(data.Tasks, cpTask)
+	}
+
+	// Walk the chain of driving predecessors back from the critical task
+	// that finishes the project last
+	last := ""
+	for _, id := range g.order {
+		node := g.nodes[id]
+		if node.ef == finish && node.ls <= node.es {
+			last = id
+		}
+	}
+
+	for id := last; id != ""; id = g.nodes[id].driver {
+		data.Path = append([]string{id}, data.Path...)
+	}
+
+	return data, nil
+}
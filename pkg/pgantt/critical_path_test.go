@@ -0,0 +1,246 @@
+//------------------------------------------------------------------------------
+// Copyright (C) 2021 Daedalean AG
+//
+// This file is part of PGantt.
+//
+// PGantt is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// PGantt is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with PGantt.  If not, see <https://www.gnu.org/licenses/>.
+//------------------------------------------------------------------------------
+
+package pgantt
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Monday to Friday, no holidays
+func testCalendar(t testing.TB) *Calendar {
+	cal, err := NewCalendar(&CalendarOpts{Weekend: []int{0, 6}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cal
+}
+
+func testTask(id, start string, dur int) *PTask {
+	return &PTask{
+		Task:  Task{Id: id, Text: id, Type: "task", StartDate: start, Duration: dur, Open: true},
+		Links: make(map[string]*Link),
+	}
+}
+
+func testLink(tasks map[string]*PTask, source, target, typ string, lag int) {
+	id := source + "#" + target
+	tasks[source].Links[id] = &Link{Id: id, Source: source, Target: target, Type: typ, Lag: lag}
+}
+
+func testTasks(tasks ...*PTask) map[string]*PTask {
+	m := make(map[string]*PTask)
+	for _, ptask := range tasks {
+		m[ptask.Task.Id] = ptask
+	}
+	return m
+}
+
+func TestCriticalPath(t *testing.T) {
+	cal := testCalendar(t)
+
+	tests := []struct {
+		name   string
+		tasks  map[string]*PTask
+		links  [][4]interface{}
+		path   []string
+		driver map[string]string
+		finish string
+	}{
+		{
+			// B starts right when A finishes, C on the Monday after B
+			// finishes on a Friday
+			name: "back-to-back FS chain",
+			tasks: testTasks(
+				testTask("A", "2021-03-01", 3),
+				testTask("B", "2021-03-04", 2),
+				testTask("C", "2021-03-08", 1),
+			),
+			links:  [][4]interface{}{{"A", "B", LinkFinishToStart, 0}, {"B", "C", LinkFinishToStart, 0}},
+			path:   []string{"A", "B", "C"},
+			driver: map[string]string{"A": "", "B": "A", "C": "B"},
+			finish: "2021-03-09",
+		},
+		{
+			name: "start to start with lag",
+			tasks: testTasks(
+				testTask("A", "2021-03-01", 5),
+				testTask("B", "2021-03-03", 4),
+			),
+			links:  [][4]interface{}{{"A", "B", LinkStartToStart, 2}},
+			path:   []string{"A", "B"},
+			driver: map[string]string{"A": "", "B": "A"},
+			finish: "2021-03-09",
+		},
+		{
+			name: "finish to finish",
+			tasks: testTasks(
+				testTask("A", "2021-03-01", 5),
+				testTask("B", "2021-03-04", 2),
+			),
+			links:  [][4]interface{}{{"A", "B", LinkFinishToFinish, 0}},
+			path:   []string{"A", "B"},
+			driver: map[string]string{"A": "", "B": "A"},
+			finish: "2021-03-06",
+		},
+		{
+			// The lag spans the weekend
+			name: "finish to start with lag",
+			tasks: testTasks(
+				testTask("A", "2021-03-01", 4),
+				testTask("B", "2021-03-09", 1),
+			),
+			links:  [][4]interface{}{{"A", "B", LinkFinishToStart, 2}},
+			path:   []string{"A", "B"},
+			driver: map[string]string{"A": "", "B": "A"},
+			finish: "2021-03-10",
+		},
+		{
+			// B starts later than A allows, so its own start drives it
+			name: "slack before the successor",
+			tasks: testTasks(
+				testTask("A", "2021-03-01", 1),
+				testTask("B", "2021-03-10", 1),
+			),
+			links:  [][4]interface{}{{"A", "B", LinkFinishToStart, 0}},
+			path:   []string{"B"},
+			driver: map[string]string{"A": "", "B": ""},
+			finish: "2021-03-11",
+		},
+		{
+			// Only the predecessor leaving no free float drives the task
+			name: "two predecessors",
+			tasks: testTasks(
+				testTask("A", "2021-03-01", 1),
+				testTask("B", "2021-03-01", 3),
+				testTask("C", "2021-03-04", 1),
+			),
+			links:  [][4]interface{}{{"A", "C", LinkFinishToStart, 0}, {"B", "C", LinkFinishToStart, 0}},
+			path:   []string{"B", "C"},
+			driver: map[string]string{"A": "", "B": "", "C": "B"},
+			finish: "2021-03-05",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, l := range test.links {
+				testLink(test.tasks, l[0].(string), l[1].(string), l[2].(string), l[3].(int))
+			}
+
+			data, err := criticalPath(test.tasks, cal)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(data.Path, test.path) {
+				t.Errorf("Expected path %v, got %v", test.path, data.Path)
+			}
+			if data.Finish != test.finish {
+				t.Errorf("Expected finish %s, got %s", test.finish, data.Finish)
+			}
+			for _, task := range data.Tasks {
+				if task.Driver != test.driver[task.Id] {
+					t.Errorf("Expected %s to be driven by %q, got %q", task.Id, test.driver[task.Id], task.Driver)
+				}
+			}
+		})
+	}
+}
+
+// The lags and leads are counted in working days, skipping the weekends, the
+// holidays and the vacations of the successor's owner
+func TestEarliestStartAfter(t *testing.T) {
+	cal := testHolidayCalendar(t)
+
+	tests := []struct {
+		name      string
+		predStart string
+		typ       string
+		lag       int
+		user      string
+		start     string
+	}{
+		{"FS", "2021-03-01", LinkFinishToStart, 0, "", "2021-03-04"},
+		{"FS lag to the weekend", "2021-03-01", LinkFinishToStart, 2, "", "2021-03-08"},
+		{"FS lag over the weekend", "2021-03-01", LinkFinishToStart, 3, "", "2021-03-09"},
+		{"FS lag over a holiday", "2021-03-08", LinkFinishToStart, 1, "", "2021-03-15"},
+		{"FS lead", "2021-03-01", LinkFinishToStart, -1, "", "2021-03-03"},
+		{"FS lead over the weekend", "2021-03-01", LinkFinishToStart, -4, "", "2021-02-26"},
+		{"SS lag", "2021-03-01", LinkStartToStart, 2, "", "2021-03-03"},
+		{"SS lag over the weekend", "2021-03-01", LinkStartToStart, 5, "", "2021-03-08"},
+		{"SS lag over a vacation", "2021-03-01", LinkStartToStart, 2, "PHID-USER-B", "2021-03-04"},
+		{"FF", "2021-03-01", LinkFinishToFinish, 0, "", "2021-03-02"},
+		{"FF lag over the weekend", "2021-03-01", LinkFinishToFinish, 3, "", "2021-03-05"},
+		{"SF", "2021-03-01", LinkStartToFinish, 0, "", "2021-02-25"},
+		{"SF lag", "2021-03-01", LinkStartToFinish, 1, "", "2021-02-26"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pred, err := newScheduleNode(&Task{Id: "A", StartDate: test.predStart, Duration: 3}, cal)
+			if err != nil {
+				t.Fatal(err)
+			}
+			succ := &scheduleNode{user: test.user, dur: 2}
+			link := &Link{Source: "A", Target: "B", Type: test.typ, Lag: test.lag}
+
+			// The successors are moved to the next working day the way
+			// analyze does it
+			start := cal.NextWorkday(earliestStartAfter(cal, link, pred, succ), test.user)
+			if formatDay(start) != test.start {
+				t.Errorf("Expected %s, got %s", test.start, formatDay(start))
+			}
+		})
+	}
+}
+
+// The successor is a two-day task that must start on Monday, 2021-03-08, and
+// finish before the holiday on Wednesday
+func TestLatestFinishBefore(t *testing.T) {
+	cal := testHolidayCalendar(t)
+
+	tests := []struct {
+		name   string
+		typ    string
+		lag    int
+		finish string
+	}{
+		{"FS", LinkFinishToStart, 0, "2021-03-08"},
+		{"FS lag over the weekend", LinkFinishToStart, 2, "2021-03-04"},
+		{"FS lead", LinkFinishToStart, -1, "2021-03-09"},
+		{"SS lag", LinkStartToStart, 1, "2021-03-10"},
+		{"FF", LinkFinishToFinish, 0, "2021-03-10"},
+		{"FF lag", LinkFinishToFinish, 1, "2021-03-09"},
+		{"SF over a holiday", LinkStartToFinish, 0, "2021-03-16"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pred := &scheduleNode{dur: 3}
+			succ := &scheduleNode{dur: 2, ls: testDay(t, "2021-03-08"), lf: testDay(t, "2021-03-10")}
+			link := &Link{Source: "A", Target: "B", Type: test.typ, Lag: test.lag}
+
+			if finish := latestFinishBefore(cal, link, pred, succ); formatDay(finish) != test.finish {
+				t.Errorf("Expected %s, got %s", test.finish, formatDay(finish))
+			}
+		})
+	}
+}
@@ -47,7 +47,13 @@ type Task struct {
 	Open        bool    `json:"open"`
 	Unscheduled bool    `json:"unscheduled"`
 	Column      string  `json:"column"`
+	Owner       string  `json:"owner"`
 	Url         string  `json:"url"`
+	Version     uint64  `json:"version"`
+	FinishDate  string  `json:"finish_date,omitempty"`
+	Project     string  `json:"project,omitempty"`
+	External    bool    `json:"external,omitempty"`
+	Readonly    bool    `json:"readonly,omitempty"`
 }
 
 type Link struct {
@@ -55,9 +61,190 @@ type Link struct {
 	Source string `json:"source"`
 	Target string `json:"target"`
 	Type   string `json:"type"`
+	Lag    int    `json:"lag"`
+}
+
+// A task moved by the automatic scheduler to satisfy its dependencies
+type TaskShift struct {
+	Id           string `json:"id"`
+	Text         string `json:"text"`
+	OldStartDate string `json:"old_start_date"`
+	StartDate    string `json:"start_date"`
 }
 
 type PlanningData struct {
 	Data  []Task `json:"data"`
 	Links []Link `json:"links"`
 }
+
+// The days off common to everyone, so that the chart counts the durations the
+// same way the server does
+type WorkCalendar struct {
+	Weekend  []int    `json:"weekend"`
+	Holidays []string `json:"holidays"`
+}
+
+// Link types as understood by dhtmlx gantt
+const (
+	LinkFinishToStart  = "0"
+	LinkStartToStart   = "1"
+	LinkFinishToFinish = "2"
+	LinkStartToFinish  = "3"
+)
+
+// Scheduling data of a task as computed by the critical path analysis. The
+// finish dates are exclusive, the same way dhtmlx treats the end dates.
+type CriticalPathTask struct {
+	Id             string `json:"id"`
+	EarliestStart  string `json:"earliest_start"`
+	EarliestFinish string `json:"earliest_finish"`
+	LatestStart    string `json:"latest_start"`
+	LatestFinish   string `json:"latest_finish"`
+	TotalFloat     int    `json:"total_float"`
+	Critical       bool   `json:"critical"`
+	Driver         string `json:"driver,omitempty"`
+}
+
+type CriticalPathData struct {
+	Start  string             `json:"start"`
+	Finish string             `json:"finish"`
+	Tasks  []CriticalPathTask `json:"tasks"`
+	Path   []string           `json:"path"`
+}
+
+// A link whose target starts earlier than the link type allows
+type LinkViolation struct {
+	Link    Link `json:"link"`
+	Overlap int  `json:"overlap"`
+}
+
+type ValidationReport struct {
+	Cycles     [][]string      `json:"cycles"`
+	Dangling   []Link          `json:"dangling"`
+	Violations []LinkViolation `json:"violations"`
+}
+
+// Kinds of plan changes pushed to the clients
+const (
+	EventTaskAdded   = "task_added"
+	EventTaskUpdated = "task_updated"
+	EventTaskRemoved = "task_removed"
+	EventLinkAdded   = "link_added"
+	EventLinkUpdated = "link_updated"
+	EventLinkRemoved = "link_removed"
+)
+
+type PlanEvent struct {
+	Type    string `json:"type"`
+	Project string `json:"project"`
+	Task    *Task  `json:"task,omitempty"`
+	Link    *Link  `json:"link,omitempty"`
+}
+
+// Scheduled work of a person on a single day or week, measured in the number
+// of tasks worked on in parallel
+type ResourceDay struct {
+	Date string  `json:"date"`
+	Load float64 `json:"load"`
+	Over bool    `json:"over"`
+}
+
+type ResourceWeek struct {
+	Week     string  `json:"week"`
+	Load     float64 `json:"load"`
+	Capacity float64 `json:"capacity"`
+	Over     bool    `json:"over"`
+}
+
+type ResourceLoad struct {
+	User       string         `json:"user"`
+	Name       string         `json:"name"`
+	Capacity   float64        `json:"capacity"`
+	Overbooked bool           `json:"overbooked"`
+	Days       []ResourceDay  `json:"days"`
+	Weeks      []ResourceWeek `json:"weeks"`
+}
+
+type ResourceReport struct {
+	Start     string         `json:"start"`
+	Finish    string         `json:"finish"`
+	Resources []ResourceLoad `json:"resources"`
+}
+
+// Saved state of a project's plan
+type Baseline struct {
+	Name    string        `json:"name"`
+	Project string        `json:"project"`
+	Created string        `json:"created"`
+	Plan    *PlanningData `json:"plan"`
+}
+
+type BaselineInfo struct {
+	Name    string `json:"name"`
+	Created string `json:"created"`
+}
+
+// Kinds of differences between a baseline and the current plan
+const (
+	VarianceAdded   = "added"
+	VarianceRemoved = "removed"
+	VarianceChanged = "changed"
+)
+
+// Difference between the baselined and the current schedule of a task, the
+// slip is measured in working days and is positive if the task moved later
+type TaskVariance struct {
+	Id                string `json:"id"`
+	Text              string `json:"text"`
+	Status            string `json:"status"`
+	BaselineStartDate string `json:"baseline_start_date,omitempty"`
+	StartDate         string `json:"start_date,omitempty"`
+	StartSlip         int    `json:"start_slip"`
+	BaselineDuration  int    `json:"baseline_duration"`
+	Duration          int    `json:"duration"`
+	DurationChange    int    `json:"duration_change"`
+}
+
+type VarianceReport struct {
+	Baseline string         `json:"baseline"`
+	Created  string         `json:"created"`
+	Tasks    []TaskVariance `json:"tasks"`
+}
+
+// A maniphest.edit call made, or in the dry-run mode only planned, by the
+// import. The object is either the PHID of the edited task or, for the tasks
+// that do not exist yet, the import key.
+type ImportStep struct {
+	Task         string        `json:"task"`
+	Object       string        `json:"object,omitempty"`
+	Transactions []Transaction `json:"transactions"`
+}
+
+type ImportReport struct {
+	DryRun  bool              `json:"dry_run"`
+	Created map[string]string `json:"created"`
+	Steps   []ImportStep      `json:"steps"`
+}
+
+// A task listed in a status report. The due date is the last working day of
+// the task, not the exclusive finish date.
+type ReportTask struct {
+	Id        string  `json:"id"`
+	Text      string  `json:"text"`
+	Url       string  `json:"url"`
+	Owner     string  `json:"owner"`
+	StartDate string  `json:"start_date,omitempty"`
+	Due       string  `json:"due,omitempty"`
+	Progress  float32 `json:"progress"`
+}
+
+type StatusReport struct {
+	Project     string          `json:"project"`
+	Name        string          `json:"name"`
+	Date        string          `json:"date"`
+	Weeks       int             `json:"weeks"`
+	Overdue     []ReportTask    `json:"overdue"`
+	Milestones  []ReportTask    `json:"milestones"`
+	Unscheduled []ReportTask    `json:"unscheduled"`
+	Changes     *VarianceReport `json:"changes"`
+}
@@ -0,0 +1,172 @@
+//------------------------------------------------------------------------------
+// Copyright (C) 2021 Daedalean AG
+//
+// This file is part of PGantt.
+//
+// PGantt is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// PGantt is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with PGantt.  If not, see <https://www.gnu.org/licenses/>.
+//------------------------------------------------------------------------------
+
+package pgantt
+
+import (
+	"sort"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// How many events may wait for a slow client before we start dropping them
+const eventBacklog = 256
+
+// Fans out the plan changes to the subscribers interested in a project
+type EventHub struct {
+	m           sync.Mutex
+	subscribers map[chan PlanEvent]string
+}
+
+func (h *EventHub) Subscribe(projPhid string) chan PlanEvent {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	if h.subscribers == nil {
+		h.subscribers = make(map[chan PlanEvent]string)
+	}
+
+	ch := make(chan PlanEvent, eventBacklog)
+	h.subscribers[ch] = projPhid
+	return ch
+}
+
+func (h *EventHub) Unsubscribe(ch chan PlanEvent) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	if _, ok := h.subscribers[ch]; ok {
+		delete(h.subscribers, ch)
+		close(ch)
+	}
+}
+
+func (h *EventHub) Publish(events []PlanEvent) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	for _, ev := range events {
+		for ch, projPhid := range h.subscribers {
+			if projPhid != ev.Project {
+				continue
+			}
+			select {
+			case ch <- ev:
+			default:
+				log.Warningf("Event queue full, dropping %s event for %s", ev.Type, projPhid)
+			}
+		}
+	}
+}
+
+// Copy of the state of a task that is not affected by the later updates of
+// the cache
+type taskSnapshot struct {
+	Mtime uint64
+	Task  Task
+	Links map[string]Link
+}
+
+func snapshotTasks(tasks map[string]*PTask) map[string]taskSnapshot {
+	snap := make(map[string]taskSnapshot, len(tasks))
+	for id, ptask := range tasks {
+		links := make(map[string]Link, len(ptask.Links))
+		for linkId, link := range ptask.Links {
+			links[linkId] = *link
+		}
+		snap[id] = taskSnapshot{ptask.Mtime, ptask.Task, links}
+	}
+	return snap
+}
+
+// Compute the events describing the difference between the snapshot and the
+// current state of the project's tasks. The changed flag is also set if only
+// the modification times differ.
+func diffTasks(projPhid string, before map[string]taskSnapshot, after map[string]*PTask) (events []PlanEvent, changed bool) {
+	ids := make([]string, 0, len(after))
+	for id := range after {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		ptask := after[id]
+		task := ptask.Task
+		old, ok := before[id]
+		if !ok {
+			events = append(events, PlanEvent{Type: EventTaskAdded, Project: projPhid, Task: &task})
+		} else {
+			if old.Mtime != ptask.Mtime {
+				changed = true
+			}
+			if old.Task != task {
+				events = append(events, PlanEvent{Type: EventTaskUpdated, Project: projPhid, Task: &task})
+			}
+		}
+
+		for _, link := range sortedLinks(ptask.Links) {
+			l := *link
+			if oldLink, ok := old.Links[link.Id]; !ok {
+				events = append(events, PlanEvent{Type: EventLinkAdded, Project: projPhid, Link: &l})
+			} else if oldLink != l {
+				events = append(events, PlanEvent{Type: EventLinkUpdated, Project: projPhid, Link: &l})
+			}
+		}
+
+		oldIds := make([]string, 0, len(old.Links))
+		for linkId := range old.Links {
+			oldIds = append(oldIds, linkId)
+		}
+		sort.Strings(oldIds)
+
+		for _, linkId := range oldIds {
+			if _, ok := ptask.Links[linkId]; !ok {
+				l := old.Links[linkId]
+				events = append(events, PlanEvent{Type: EventLinkRemoved, Project: projPhid, Link: &l})
+			}
+		}
+	}
+
+	removed := []string{}
+	for id := range before {
+		if _, ok := after[id]; !ok {
+			removed = append(removed, id)
+		}
+	}
+	sort.Strings(removed)
+
+	for _, id := range removed {
+		task := before[id].Task
+		events = append(events, PlanEvent{Type: EventTaskRemoved, Project: projPhid, Task: &task})
+	}
+
+	return events, changed || len(events) != 0
+}
+
+func sortedLinks(links map[string]*Link) []*Link {
+	sorted := make([]*Link, 0, len(links))
+	for _, link := range links {
+		sorted = append(sorted, link)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Id < sorted[j].Id
+	})
+	return sorted
+}
@@ -0,0 +1,434 @@
+//------------------------------------------------------------------------------
+// Copyright (C) 2021 Daedalean AG
+//
+// This file is part of PGantt.
+//
+// PGantt is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// PGantt is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with PGantt.  If not, see <https://www.gnu.org/licenses/>.
+//------------------------------------------------------------------------------
+
+package pgantt
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Supported export and import formats
+const (
+	FormatCSV   = "csv"
+	FormatJSON  = "json"
+	FormatMSPDI = "xml"
+)
+
+// Serialize the plan in one of the supported formats
+func exportPlan(format, name string, plan *PlanningData, cal *Calendar) ([]byte, error) {
+	switch format {
+	case FormatCSV:
+		return exportCSV(plan)
+	case FormatJSON:
+		data, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("Cannot serialize the plan: %s", err)
+		}
+		return data, nil
+	case FormatMSPDI:
+		return exportMSPDI(name, plan, cal)
+	}
+	return nil, fmt.Errorf("Unsupported export format: %q", format)
+}
+
+// The link types as written in the CSV files
+var csvLinkNames = map[string]string{
+	LinkFinishToStart:  "FS",
+	LinkStartToStart:   "SS",
+	LinkFinishToFinish: "FF",
+	LinkStartToFinish:  "SF",
+}
+
+// Write the plan in the CSV format understood by the import
+func exportCSV(plan *PlanningData) ([]byte, error) {
+	tasks := make(map[string]bool)
+	for _, task := range plan.Data {
+		if !task.External {
+			tasks[task.Id] = true
+		}
+	}
+
+	successors := make(map[string][]string)
+	for _, link := range plan.Links {
+		if !tasks[link.Source] || !tasks[link.Target] {
+			continue
+		}
+		succ := link.Target
+		if link.Type != LinkFinishToStart || link.Lag != 0 {
+			succ += ":" + csvLinkNames[link.Type]
+		}
+		if link.Lag != 0 {
+			succ += fmt.Sprintf("%+d", link.Lag)
+		}
+		successors[link.Source] = append(successors[link.Source], succ)
+	}
+
+	buf := &bytes.Buffer{}
+	writer := csv.NewWriter(buf)
+	writer.Write([]string{"id", "parent", "name", "type", "start_date", "duration", "progress", "successors"})
+	for _, task := range plan.Data {
+		if !tasks[task.Id] {
+			continue
+		}
+		parent := task.Parent
+		if !tasks[parent] {
+			parent = ""
+		}
+		sort.Strings(successors[task.Id])
+		writer.Write([]string{
+			task.Id,
+			parent,
+			task.Text,
+			task.Type,
+			task.StartDate,
+			fmt.Sprintf("%d", task.Duration),
+			fmt.Sprintf("%d", int(math.Round(float64(task.Progress)*100))),
+			strings.Join(successors[task.Id], ";"),
+		})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, fmt.Errorf("Cannot serialize the plan: %s", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Microsoft Project XML (MSPDI) export. MS Project counts the durations in
+// hours and the link lags in tenths of a minute, assuming 8-hour working days.
+const (
+	mspdiNamespace  = "http://schemas.microsoft.com/project"
+	mspdiTimeFormat = "2006-01-02T15:04:05"
+	mspdiDayStart   = 8 * 60 * 60
+	mspdiDayEnd     = 17 * 60 * 60
+	mspdiLagPerDay  = 4800
+	mspdiFormatDays = 7
+)
+
+// The link types of dhtmlx-gantt mapped to the MSPDI ones
+var mspdiLinkTypes = map[string]int{
+	LinkFinishToFinish: 0,
+	LinkFinishToStart:  1,
+	LinkStartToFinish:  2,
+	LinkStartToStart:   3,
+}
+
+type mspdiProject struct {
+	XMLName           xml.Name        `xml:"Project"`
+	Xmlns             string          `xml:"xmlns,attr"`
+	Name              string          `xml:"Name"`
+	Title             string          `xml:"Title"`
+	ScheduleFromStart int             `xml:"ScheduleFromStart"`
+	StartDate         string          `xml:"StartDate,omitempty"`
+	FinishDate        string          `xml:"FinishDate,omitempty"`
+	CalendarUID       int             `xml:"CalendarUID"`
+	DefaultStartTime  string          `xml:"DefaultStartTime"`
+	DefaultFinishTime string          `xml:"DefaultFinishTime"`
+	MinutesPerDay     int             `xml:"MinutesPerDay"`
+	MinutesPerWeek    int             `xml:"MinutesPerWeek"`
+	DaysPerMonth      int             `xml:"DaysPerMonth"`
+	Calendars         []mspdiCalendar `xml:"Calendars>Calendar"`
+	Tasks             []mspdiTask     `xml:"Tasks>Task"`
+}
+
+type mspdiCalendar struct {
+	UID            int            `xml:"UID"`
+	Name           string         `xml:"Name"`
+	IsBaseCalendar int            `xml:"IsBaseCalendar"`
+	WeekDays       []mspdiWeekDay `xml:"WeekDays>WeekDay"`
+}
+
+// Day type 0 stands for an exception spanning the time period, 1 to 7 for the
+// days of the week starting on Sunday
+type mspdiWeekDay struct {
+	DayType      int                `xml:"DayType"`
+	DayWorking   int                `xml:"DayWorking"`
+	TimePeriod   *mspdiTimePeriod   `xml:"TimePeriod,omitempty"`
+	WorkingTimes []mspdiWorkingTime `xml:"WorkingTimes>WorkingTime,omitempty"`
+}
+
+type mspdiTimePeriod struct {
+	FromDate string `xml:"FromDate"`
+	ToDate   string `xml:"ToDate"`
+}
+
+type mspdiWorkingTime struct {
+	FromTime string `xml:"FromTime"`
+	ToTime   string `xml:"ToTime"`
+}
+
+type mspdiTask struct {
+	UID              int                `xml:"UID"`
+	ID               int                `xml:"ID"`
+	Name             string             `xml:"Name"`
+	Type             int                `xml:"Type"`
+	OutlineNumber    string             `xml:"OutlineNumber"`
+	OutlineLevel     int                `xml:"OutlineLevel"`
+	Start            string             `xml:"Start,omitempty"`
+	Finish           string             `xml:"Finish,omitempty"`
+	Duration         string             `xml:"Duration,omitempty"`
+	DurationFormat   int                `xml:"DurationFormat"`
+	Estimated        int                `xml:"Estimated"`
+	Milestone        int                `xml:"Milestone"`
+	Summary          int                `xml:"Summary"`
+	PercentComplete  int                `xml:"PercentComplete"`
+	HyperlinkAddress string             `xml:"HyperlinkAddress,omitempty"`
+	PredecessorLinks []mspdiPredecessor `xml:"PredecessorLink"`
+}
+
+type mspdiPredecessor struct {
+	PredecessorUID int `xml:"PredecessorUID"`
+	Type           int `xml:"Type"`
+	LinkLag        int `xml:"LinkLag"`
+	LagFormat      int `xml:"LagFormat"`
+}
+
+func mspdiTime(day, seconds int) string {
+	return dayTime(day).Add(time.Duration(seconds) * time.Second).Format(mspdiTimeFormat)
+}
+
+// The span ends at the end of its last day, unless it is empty
+func mspdiFinish(start, finish int) string {
+	if finish <= start {
+		return mspdiTime(start, mspdiDayStart)
+	}
+	return mspdiTime(finish-1, mspdiDayEnd)
+}
+
+func mspdiDuration(days int) string {
+	return fmt.Sprintf("PT%dH0M0S", days*8)
+}
+
+// The standard calendar with the common days off as exceptions
+func mspdiStandardCalendar(cal *Calendar) mspdiCalendar {
+	c := mspdiCalendar{UID: 1, Name: "Standard", IsBaseCalendar: 1}
+
+	workingTimes := []mspdiWorkingTime{
+		{"08:00:00", "12:00:00"},
+		{"13:00:00", "17:00:00"},
+	}
+
+	for wd := 0; wd < 7; wd++ {
+		day := mspdiWeekDay{DayType: wd + 1}
+		if cal == nil || !cal.weekend[wd] {
+			day.DayWorking = 1
+			day.WorkingTimes = workingTimes
+		}
+		c.WeekDays = append(c.WeekDays, day)
+	}
+
+	if cal == nil {
+		return c
+	}
+
+	holidays := make([]int, 0, len(cal.holidays))
+	for day := range cal.holidays {
+		holidays = append(holidays, day)
+	}
+	sort.Ints(holidays)
+
+	// Consecutive days off make a single exception
+	for i := 0; i < len(holidays); {
+		j := i
+		for j+1 < len(holidays) && holidays[j+1] == holidays[j]+1 {
+			j++
+		}
+		c.WeekDays = append(c.WeekDays, mspdiWeekDay{
+			DayType: 0,
+			TimePeriod: &mspdiTimePeriod{
+				FromDate: mspdiTime(holidays[i], 0),
+				ToDate:   mspdiTime(holidays[j], 24*60*60-60),
+			},
+		})
+		i = j + 1
+	}
+	return c
+}
+
+// Serialize the plan as an MSPDI document. The tasks are listed in the outline
+// order, the children right after their parents.
+func exportMSPDI(name string, plan *PlanningData, cal *Calendar) ([]byte, error) {
+	project := &mspdiProject{
+		Xmlns:             mspdiNamespace,
+		Name:              name + ".xml",
+		Title:             name,
+		ScheduleFromStart: 1,
+		CalendarUID:       1,
+		DefaultStartTime:  "08:00:00",
+		DefaultFinishTime: "17:00:00",
+		MinutesPerDay:     480,
+		MinutesPerWeek:    2400,
+		DaysPerMonth:      20,
+		Calendars:         []mspdiCalendar{mspdiStandardCalendar(cal)},
+		Tasks:             make([]mspdiTask, 0),
+	}
+
+	tasks := make(map[string]Task)
+	for _, task := range plan.Data {
+		if !task.External {
+			tasks[task.Id] = task
+		}
+	}
+
+	children := make(map[string][]string)
+	for id, task := range tasks {
+		parent := task.Parent
+		if _, ok := tasks[parent]; !ok {
+			parent = ""
+		}
+		children[parent] = append(children[parent], id)
+	}
+	for _, ids := range children {
+		sort.Strings(ids)
+	}
+
+	// The span of every scheduled task, summaries span their children
+	type span struct{ start, finish int }
+	spans := make(map[string]span)
+	var spanOf func(id string) (span, bool)
+	spanOf = func(id string) (span, bool) {
+		if s, ok := spans[id]; ok {
+			return s, true
+		}
+		task := tasks[id]
+		if len(children[id]) == 0 {
+			node, err := newScheduleNode(&task, cal)
+			if err != nil || node == nil {
+				return span{}, false
+			}
+			s := span{node.start, node.ef}
+			spans[id] = s
+			return s, true
+		}
+		s, found := span{}, false
+		for _, child := range children[id] {
+			cs, ok := spanOf(child)
+			if !ok {
+				continue
+			}
+			if !found || cs.start < s.start {
+				s.start = cs.start
+			}
+			if !found || cs.finish > s.finish {
+				s.finish = cs.finish
+			}
+			found = true
+		}
+		if found {
+			spans[id] = s
+		}
+		return s, found
+	}
+
+	uids := make(map[string]int)
+	order := []string{}
+	outline := make(map[string]string)
+	var visit func(id, prefix string)
+	visit = func(id, prefix string) {
+		for i, child := range children[id] {
+			if _, ok := uids[child]; ok {
+				continue
+			}
+			uids[child] = len(order) + 1
+			order = append(order, child)
+			outline[child] = fmt.Sprintf("%s%d", prefix, i+1)
+			visit(child, outline[child]+".")
+		}
+	}
+	visit("", "")
+
+	preds := make(map[string][]mspdiPredecessor)
+	for _, link := range plan.Links {
+		source, ok := uids[link.Source]
+		if !ok {
+			continue
+		}
+		if _, ok := uids[link.Target]; !ok {
+			continue
+		}
+		typ, ok := mspdiLinkTypes[link.Type]
+		if !ok {
+			typ = mspdiLinkTypes[LinkFinishToStart]
+		}
+		preds[link.Target] = append(preds[link.Target], mspdiPredecessor{
+			PredecessorUID: source,
+			Type:           typ,
+			LinkLag:        link.Lag * mspdiLagPerDay,
+			LagFormat:      mspdiFormatDays,
+		})
+	}
+
+	for _, id := range order {
+		task := tasks[id]
+		mt := mspdiTask{
+			UID:              uids[id],
+			ID:               uids[id],
+			Name:             task.Text,
+			Type:             1, // Fixed duration
+			OutlineNumber:    outline[id],
+			OutlineLevel:     strings.Count(outline[id], ".") + 1,
+			DurationFormat:   mspdiFormatDays,
+			PercentComplete:  int(math.Round(float64(task.Progress) * 100)),
+			HyperlinkAddress: task.Url,
+			PredecessorLinks: preds[id],
+		}
+
+		if len(children[id]) != 0 || task.Type == "project" {
+			mt.Summary = 1
+		}
+
+		if task.Type == "milestone" {
+			mt.Milestone = 1
+		}
+
+		s, ok := spanOf(id)
+		switch {
+		case !ok:
+			mt.Estimated = 1
+			mt.Duration = mspdiDuration(task.Duration)
+		default:
+			mt.Start = mspdiTime(s.start, mspdiDayStart)
+			mt.Finish = mspdiFinish(s.start, s.finish)
+			mt.Duration = mspdiDuration(cal.Workdays(s.start, s.finish, task.Owner))
+		}
+
+		// The timestamps sort lexicographically
+		if mt.Start != "" && (project.StartDate == "" || mt.Start < project.StartDate) {
+			project.StartDate = mt.Start
+		}
+		if mt.Finish > project.FinishDate {
+			project.FinishDate = mt.Finish
+		}
+
+		project.Tasks = append(project.Tasks, mt)
+	}
+
+	data, err := xml.MarshalIndent(project, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("Cannot serialize the project: %s", err)
+	}
+	return append([]byte(xml.Header), data...), nil
+}
@@ -0,0 +1,108 @@
+//------------------------------------------------------------------------------
+// Copyright (C) 2021 Daedalean AG
+//
+// This file is part of PGantt.
+//
+// PGantt is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// PGantt is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with PGantt.  If not, see <https://www.gnu.org/licenses/>.
+//------------------------------------------------------------------------------
+
+package pgantt
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	icalDayFormat   = "20060102"
+	icalStampFormat = "20060102T150405Z"
+	icalLineLength  = 75
+)
+
+var icalEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+
+// Write a content line, folding it so that no line is longer than 75 octets
+// and no UTF-8 sequence gets split
+func writeICalLine(buf *bytes.Buffer, line string) {
+	limit := icalLineLength
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		buf.WriteString(line[:cut])
+		buf.WriteString("\r\n ")
+		line = line[cut:]
+		// The leading space of the continuation counts towards its length
+		limit = icalLineLength - 1
+	}
+	buf.WriteString(line)
+	buf.WriteString("\r\n")
+}
+
+// Turn the milestones of the plan, and optionally all the other scheduled
+// tasks, into the events of an iCalendar feed. The events span whole days,
+// and the end date is exclusive, just like the finish date of the tasks.
+func exportICal(name string, plan *PlanningData, cal *Calendar, all bool, now time.Time) []byte {
+	buf := &bytes.Buffer{}
+	writeICalLine(buf, "BEGIN:VCALENDAR")
+	writeICalLine(buf, "VERSION:2.0")
+	writeICalLine(buf, "PRODID:-//Daedalean//PGantt//EN")
+	writeICalLine(buf, "CALSCALE:GREGORIAN")
+	writeICalLine(buf, "METHOD:PUBLISH")
+	writeICalLine(buf, "X-WR-CALNAME:"+icalEscaper.Replace(name))
+
+	tasks := make([]Task, 0, len(plan.Data))
+	for _, task := range plan.Data {
+		if !task.External && (all || task.Type == "milestone") {
+			tasks = append(tasks, task)
+		}
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].Id < tasks[j].Id
+	})
+
+	stamp := now.UTC().Format(icalStampFormat)
+	for _, task := range tasks {
+		node, err := newScheduleNode(&task, cal)
+		if err != nil || node == nil {
+			continue
+		}
+
+		// Milestones take no time, but the event needs to cover their day
+		finish := node.ef
+		if finish <= node.start {
+			finish = node.start + 1
+		}
+
+		writeICalLine(buf, "BEGIN:VEVENT")
+		writeICalLine(buf, "UID:"+task.Id+"@pgantt")
+		writeICalLine(buf, "DTSTAMP:"+stamp)
+		writeICalLine(buf, "DTSTART;VALUE=DATE:"+dayTime(node.start).Format(icalDayFormat))
+		writeICalLine(buf, "DTEND;VALUE=DATE:"+dayTime(finish).Format(icalDayFormat))
+		writeICalLine(buf, "SUMMARY:"+icalEscaper.Replace(task.Text))
+		writeICalLine(buf, "TRANSP:TRANSPARENT")
+		if task.Url != "" {
+			writeICalLine(buf, "URL:"+task.Url)
+			writeICalLine(buf, "DESCRIPTION:"+icalEscaper.Replace(task.Url))
+		}
+		writeICalLine(buf, "END:VEVENT")
+	}
+
+	writeICalLine(buf, "END:VCALENDAR")
+	return buf.Bytes()
+}
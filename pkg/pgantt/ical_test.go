@@ -0,0 +1,105 @@
+//------------------------------------------------------------------------------
+// Copyright (C) 2021 Daedalean AG
+//
+// This file is part of PGantt.
+//
+// PGantt is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// PGantt is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with PGantt.  If not, see <https://www.gnu.org/licenses/>.
+//------------------------------------------------------------------------------
+
+package pgantt
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestWriteICalLine(t *testing.T) {
+	tests := []struct {
+		name  string
+		line  string
+		lines []int
+	}{
+		{"short", "SUMMARY:Release", []int{15}},
+		{"exactly the limit", "SUMMARY:" + strings.Repeat("x", 67), []int{75}},
+		{"one octet over", "SUMMARY:" + strings.Repeat("x", 68), []int{75, 2}},
+		{"several continuations", "SUMMARY:" + strings.Repeat("x", 200), []int{75, 75, 60}},
+		// The two-octet runes would straddle the 75th octet
+		{"multi-byte", "SUMMARY:" + strings.Repeat("é", 40), []int{74, 15}},
+		{"four-byte", "SUMMARY:" + strings.Repeat("😀", 20), []int{72, 17}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			writeICalLine(buf, test.line)
+			data := buf.String()
+
+			if !strings.HasSuffix(data, "\r\n") {
+				t.Fatalf("The line is not terminated: %q", data)
+			}
+			lines := strings.Split(strings.TrimSuffix(data, "\r\n"), "\r\n")
+			lengths := []int{}
+			for i, line := range lines {
+				lengths = append(lengths, len(line))
+				if !utf8.ValidString(line) {
+					t.Errorf("Line %d splits a UTF-8 sequence: %q", i, line)
+				}
+				if i != 0 && !strings.HasPrefix(line, " ") {
+					t.Errorf("Continuation %d does not start with a space: %q", i, line)
+				}
+			}
+			if !reflect.DeepEqual(lengths, test.lines) {
+				t.Errorf("Expected lines of %v octets, got %v", test.lines, lengths)
+			}
+
+			if unfolded := strings.ReplaceAll(strings.TrimSuffix(data, "\r\n"), "\r\n ", ""); unfolded != test.line {
+				t.Errorf("Expected %q after unfolding, got %q", test.line, unfolded)
+			}
+		})
+	}
+}
+
+// The feed reads back as a holiday file, the long names notwithstanding
+func TestExportICalFolded(t *testing.T) {
+	plan := &PlanningData{Data: []Task{
+		{Id: "M", Text: strings.Repeat("Release, ", 20), Type: "milestone", StartDate: "2021-03-08"},
+		{Id: "A", Text: "Design", Type: "task", StartDate: "2021-03-01", Duration: 3},
+	}}
+
+	data := exportICal("Plan", plan, testCalendar(t), false, time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC))
+	for _, line := range strings.Split(string(data), "\r\n") {
+		if len(line) > icalLineLength {
+			t.Errorf("Line longer than %d octets: %q", icalLineLength, line)
+		}
+	}
+
+	fileName := filepath.Join(t.TempDir(), "plan.ics")
+	if err := ioutil.WriteFile(fileName, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	cal, err := NewCalendar(&CalendarOpts{HolidayFiles: []string{fileName}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	holidays := cal.WorkCalendar().Holidays
+	if len(holidays) != 1 || holidays[0] != "2021-03-08" {
+		t.Errorf("Expected only the milestone day, got %v", holidays)
+	}
+}
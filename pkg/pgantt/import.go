@@ -0,0 +1,468 @@
+//------------------------------------------------------------------------------
+// Copyright (C) 2021 Daedalean AG
+//
+// This file is part of PGantt.
+//
+// PGantt is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// PGantt is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with PGantt.  If not, see <https://www.gnu.org/licenses/>.
+//------------------------------------------------------------------------------
+
+package pgantt
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A task to be created by the import, identified by a key that is only
+// meaningful within the imported file
+type importTask struct {
+	key        string
+	parent     string
+	text       string
+	typ        string
+	startDate  string
+	duration   int
+	progress   float32
+	successors []importLink
+}
+
+type importLink struct {
+	target string
+	typ    string
+	lag    int
+}
+
+// Guess the format from the contents unless it is given explicitly
+func parseImport(format string, data []byte) ([]*importTask, error) {
+	if format == "" {
+		format = FormatCSV
+		if bytes.HasPrefix(bytes.TrimSpace(data), []byte("<")) {
+			format = FormatMSPDI
+		}
+	}
+
+	switch format {
+	case FormatCSV:
+		return parseImportCSV(data)
+	case FormatMSPDI:
+		return parseImportMSPDI(data)
+	}
+	return nil, fmt.Errorf("Unsupported import format: %q", format)
+}
+
+// Parse an MSPDI document, the hierarchy is given by the outline numbers
+func parseImportMSPDI(data []byte) ([]*importTask, error) {
+	project := &mspdiProject{}
+	if err := xml.Unmarshal(data, project); err != nil {
+		return nil, fmt.Errorf("Malformed MSPDI document: %s", err)
+	}
+
+	linkTypes := make(map[int]string)
+	for typ, mspdiTyp := range mspdiLinkTypes {
+		linkTypes[mspdiTyp] = typ
+	}
+
+	uids := make(map[int]*importTask)
+	outlines := make(map[string]string)
+	tasks := []*importTask{}
+	for _, mt := range project.Tasks {
+		// The project summary task
+		if mt.UID == 0 || mt.OutlineLevel == 0 {
+			continue
+		}
+
+		task := &importTask{
+			key:      strconv.Itoa(mt.UID),
+			text:     mt.Name,
+			typ:      "task",
+			progress: float32(mt.PercentComplete) / 100,
+		}
+
+		switch {
+		case mt.Milestone == 1:
+			task.typ = "milestone"
+		case mt.Summary == 1:
+			task.typ = "project"
+		}
+
+		// The summary tasks span their children anyway
+		if mt.Start != "" && task.typ != "project" {
+			tm, err := time.Parse(mspdiTimeFormat, mt.Start)
+			if err != nil {
+				return nil, fmt.Errorf("Malformed start date of task %d: %s", mt.UID, err)
+			}
+			task.startDate = tm.Format(dayFormat)
+		}
+
+		if mt.Duration != "" && task.typ == "task" {
+			hours, err := parseMSPDIDuration(mt.Duration)
+			if err != nil {
+				return nil, fmt.Errorf("Malformed duration of task %d: %s", mt.UID, err)
+			}
+			task.duration = int(math.Ceil(hours / 8))
+		}
+
+		outlines[mt.OutlineNumber] = task.key
+		if i := strings.LastIndex(mt.OutlineNumber, "."); i != -1 {
+			task.parent = mt.OutlineNumber[:i]
+		}
+
+		uids[mt.UID] = task
+		tasks = append(tasks, task)
+	}
+
+	for _, mt := range project.Tasks {
+		for _, pred := range mt.PredecessorLinks {
+			source, ok := uids[pred.PredecessorUID]
+			if !ok {
+				return nil, fmt.Errorf("Task %d depends on an unknown task %d", mt.UID, pred.PredecessorUID)
+			}
+			typ, ok := linkTypes[pred.Type]
+			if !ok {
+				return nil, fmt.Errorf("Unknown link type %d of task %d", pred.Type, mt.UID)
+			}
+			source.successors = append(source.successors, importLink{
+				target: strconv.Itoa(mt.UID),
+				typ:    typ,
+				lag:    pred.LinkLag / mspdiLagPerDay,
+			})
+		}
+	}
+
+	// Turn the parent outline numbers into keys
+	for _, task := range tasks {
+		if task.parent == "" {
+			continue
+		}
+		parent, ok := outlines[task.parent]
+		if !ok {
+			return nil, fmt.Errorf("Task %s has no parent with the outline number %s", task.key, task.parent)
+		}
+		task.parent = parent
+	}
+
+	return tasks, nil
+}
+
+var mspdiDurationRe = regexp.MustCompile(`^PT([0-9.]+)H([0-9.]+)M([0-9.]+)S$`)
+
+// Number of hours in an MSPDI duration
+func parseMSPDIDuration(duration string) (float64, error) {
+	m := mspdiDurationRe.FindStringSubmatch(duration)
+	if m == nil {
+		return 0, fmt.Errorf("Unsupported duration: %q", duration)
+	}
+	hours, _ := strconv.ParseFloat(m[1], 64)
+	minutes, _ := strconv.ParseFloat(m[2], 64)
+	seconds, _ := strconv.ParseFloat(m[3], 64)
+	return hours + minutes/60 + seconds/3600, nil
+}
+
+// The link type is separated from the id with a colon, so that the ids may end
+// with the letters of a link type, and the lag can only follow the type, so
+// that the ids may contain dashes
+var csvSuccessorRe = regexp.MustCompile(`^([^:]+)(?::(FS|SS|FF|SF)([+-][0-9]+)?)?$`)
+
+var csvLinkTypes = map[string]string{
+	"FS": LinkFinishToStart,
+	"SS": LinkStartToStart,
+	"FF": LinkFinishToFinish,
+	"SF": LinkStartToFinish,
+}
+
+// Parse a CSV file with a header line naming the columns: id, parent, name,
+// type, start_date, duration, progress and successors. Only id and name are
+// mandatory. The progress is in percent and the successors are separated with
+// semicolons, e.g. "3;4:SS+2" for a finish-to-start link to task 3 and
+// a start-to-start link with a lag of 2 days to task 4. The ids cannot contain
+// colons.
+func parseImportCSV(data []byte) ([]*importTask, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("Malformed CSV file: %s", err)
+	}
+
+	if len(records) == 0 {
+		return nil, fmt.Errorf("The CSV file has no header")
+	}
+
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	for _, name := range []string{"id", "name"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("The CSV file has no %q column", name)
+		}
+	}
+
+	tasks := []*importTask{}
+	for i, record := range records[1:] {
+		line := i + 2
+		field := func(name string) string {
+			if col, ok := columns[name]; ok && col < len(record) {
+				return strings.TrimSpace(record[col])
+			}
+			return ""
+		}
+
+		task := &importTask{
+			key:       field("id"),
+			parent:    field("parent"),
+			text:      field("name"),
+			typ:       strings.ToLower(field("type")),
+			startDate: field("start_date"),
+		}
+
+		if task.key == "" {
+			return nil, fmt.Errorf("Line %d: missing task id", line)
+		}
+
+		switch task.typ {
+		case "":
+			task.typ = "task"
+		case "task", "milestone", "project":
+		default:
+			return nil, fmt.Errorf("Line %d: unknown task type %q", line, task.typ)
+		}
+
+		if task.startDate != "" {
+			if _, err := parseDay(task.startDate); err != nil {
+				return nil, fmt.Errorf("Line %d: malformed start date: %s", line, err)
+			}
+		}
+
+		if duration := field("duration"); duration != "" {
+			if task.duration, err = strconv.Atoi(duration); err != nil || task.duration < 0 {
+				return nil, fmt.Errorf("Line %d: malformed duration %q", line, duration)
+			}
+		}
+
+		if progress := strings.TrimSuffix(field("progress"), "%"); progress != "" {
+			percent, err := strconv.ParseFloat(progress, 32)
+			if err != nil || percent < 0 || percent > 100 {
+				return nil, fmt.Errorf("Line %d: malformed progress %q", line, progress)
+			}
+			task.progress = float32(percent / 100)
+		}
+
+		for _, succ := range strings.Split(field("successors"), ";") {
+			succ = strings.TrimSpace(succ)
+			if succ == "" {
+				continue
+			}
+			m := csvSuccessorRe.FindStringSubmatch(succ)
+			if m == nil {
+				return nil, fmt.Errorf("Line %d: malformed successor %q", line, succ)
+			}
+			link := importLink{target: m[1], typ: LinkFinishToStart}
+			if m[2] != "" {
+				link.typ = csvLinkTypes[m[2]]
+			}
+			if m[3] != "" {
+				link.lag, _ = strconv.Atoi(m[3])
+			}
+			task.successors = append(task.successors, link)
+		}
+
+		tasks = append(tasks, task)
+	}
+
+	return tasks, nil
+}
+
+// Order the tasks so that the parents come before their children, and check
+// that all the references can be resolved
+func sortImport(tasks []*importTask) ([]*importTask, error) {
+	byKey := make(map[string]*importTask)
+	for _, task := range tasks {
+		if _, ok := byKey[task.key]; ok {
+			return nil, fmt.Errorf("Duplicate task id: %q", task.key)
+		}
+		byKey[task.key] = task
+	}
+
+	for _, task := range tasks {
+		if _, ok := byKey[task.parent]; task.parent != "" && !ok {
+			return nil, fmt.Errorf("Task %q has an unknown parent %q", task.key, task.parent)
+		}
+		for _, link := range task.successors {
+			if _, ok := byKey[link.target]; !ok {
+				return nil, fmt.Errorf("Task %q has an unknown successor %q", task.key, link.target)
+			}
+		}
+	}
+
+	ordered := make([]*importTask, 0, len(tasks))
+	done := make(map[string]bool)
+	var visit func(task *importTask, depth int) error
+	visit = func(task *importTask, depth int) error {
+		if done[task.key] {
+			return nil
+		}
+		if depth > len(tasks) {
+			return fmt.Errorf("Task %q is its own ancestor", task.key)
+		}
+		if task.parent != "" {
+			if err := visit(byKey[task.parent], depth+1); err != nil {
+				return err
+			}
+		}
+		done[task.key] = true
+		ordered = append(ordered, task)
+		return nil
+	}
+
+	for _, task := range tasks {
+		if err := visit(task, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := checkImportCycles(ordered); err != nil {
+		return nil, err
+	}
+	return ordered, nil
+}
+
+// The links follow the same rules as the ones made in the chart: the repeated
+// ones are dropped, and two tasks cannot be linked in two different ways
+func checkImportCycles(tasks []*importTask) error {
+	ptasks := make(map[string]*PTask)
+	for _, task := range tasks {
+		ptask := &PTask{Task: Task{Id: task.key, Text: task.text}, Links: make(map[string]*Link)}
+		successors := []importLink{}
+		for _, succ := range task.successors {
+			link := &Link{Source: task.key, Target: succ.target, Type: succ.typ, Lag: succ.lag}
+			added, err := addLink(ptask.Links, link)
+			if err != nil {
+				return err
+			}
+			if added == link {
+				successors = append(successors, succ)
+			}
+		}
+		task.successors = successors
+		ptasks[task.key] = ptask
+	}
+
+	cycles := findCycles(linkGraph(ptasks))
+	if len(cycles) != 0 {
+		return fmt.Errorf("The imported links form a dependency cycle: %s",
+			describeTaskChain(ptasks, append(cycles[0], cycles[0][0])))
+	}
+	return nil
+}
+
+// Create the tasks in the project, the parents first, and then link them. In
+// the dry-run mode, the steps are only reported, and the tasks that would have
+// been created are referred to as "import:<id>".
+func runImport(phab *Phabricator, projPhid, column string, tasks []*importTask,
+	dryRun bool) (*ImportReport, error) {
+
+	tasks, err := sortImport(tasks)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ImportReport{
+		DryRun:  dryRun,
+		Created: make(map[string]string),
+		Steps:   make([]ImportStep, 0),
+	}
+
+	phids := make(map[string]string)
+	phidOf := func(key string) string {
+		if phid, ok := phids[key]; ok {
+			return phid
+		}
+		return "import:" + key
+	}
+
+	apply := func(key string, req *EditRequest) error {
+		report.Steps = append(report.Steps, ImportStep{key, req.ObjectIdentifier, req.Transactions})
+		if dryRun {
+			return nil
+		}
+		phid, err := phab.EditTask(req)
+		if err != nil {
+			return fmt.Errorf("Cannot import task %q: %s", key, err)
+		}
+		if req.ObjectIdentifier == "" {
+			phids[key] = phid
+			report.Created[key] = phid
+		}
+		return nil
+	}
+
+	for _, task := range tasks {
+		req := EditRequest{}
+		req.SetProject(projPhid)
+		if task.parent != "" {
+			req.SetParent(phidOf(task.parent))
+		}
+		if column != "" {
+			req.SetColumn(column)
+		}
+		req.SetTitle(task.text)
+		req.SetScheduled(task.startDate != "")
+		if task.startDate != "" {
+			tm, _ := time.Parse(dayFormat, task.startDate)
+			req.SetStartDate(tm.Unix())
+			req.SetDuration(task.duration)
+		}
+		req.SetProgress(task.progress)
+		req.SetType(task.typ)
+
+		if err := apply(task.key, &req); err != nil {
+			return report, err
+		}
+	}
+
+	// The links need to know the PHIDs of both ends
+	for _, task := range tasks {
+		if len(task.successors) == 0 {
+			continue
+		}
+
+		successors := make([]PLinkData, 0, len(task.successors))
+		for _, link := range task.successors {
+			successors = append(successors, PLinkData{phidOf(link.target), link.typ, link.lag})
+		}
+		sort.Slice(successors, func(i, j int) bool {
+			return successors[i].Target < successors[j].Target
+		})
+
+		req := EditRequest{}
+		req.SetObjectId(phidOf(task.key))
+		req.SetSuccessors(successors)
+
+		if err := apply(task.key, &req); err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
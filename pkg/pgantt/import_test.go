@@ -0,0 +1,209 @@
+//------------------------------------------------------------------------------
+// Copyright (C) 2021 Daedalean AG
+//
+// This file is part of PGantt.
+//
+// PGantt is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// PGantt is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with PGantt.  If not, see <https://www.gnu.org/licenses/>.
+//------------------------------------------------------------------------------
+
+package pgantt
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestImportSuccessors(t *testing.T) {
+	tests := []struct {
+		successors string
+		links      []importLink
+	}{
+		{"3", []importLink{{"3", LinkFinishToStart, 0}}},
+		{"3;4:SS+2", []importLink{{"3", LinkFinishToStart, 0}, {"4", LinkStartToStart, 2}}},
+		{"4:FF-1", []importLink{{"4", LinkFinishToFinish, -1}}},
+		// The ids ending with the letters of a link type are not split
+		{"CONF", []importLink{{"CONF", LinkFinishToStart, 0}}},
+		{"CONF:SF", []importLink{{"CONF", LinkStartToFinish, 0}}},
+		{"task-1:FS+3", []importLink{{"task-1", LinkFinishToStart, 3}}},
+		{"4:XX", nil},
+		{"4:+2", nil},
+		{"4:SS:FF", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.successors, func(t *testing.T) {
+			data := "id,name,successors\n1,First,\"" + test.successors + "\"\n"
+			tasks, err := parseImport(FormatCSV, []byte(data))
+			if test.links == nil {
+				if err == nil {
+					t.Errorf("Malformed successors accepted: %+v", tasks[0].successors)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(tasks[0].successors, test.links) {
+				t.Errorf("Expected %+v, got %+v", test.links, tasks[0].successors)
+			}
+		})
+	}
+}
+
+// What the export writes, the import reads back
+func TestImportExportedCSV(t *testing.T) {
+	plan := &PlanningData{
+		Data: []Task{
+			{Id: "A", Text: "First", Type: "task", StartDate: "2021-03-01", Duration: 3},
+			{Id: "B", Text: "Second", Type: "task", Parent: "A", StartDate: "2021-03-04", Duration: 2},
+			{Id: "C", Text: "Third", Type: "milestone", StartDate: "2021-03-08"},
+		},
+		Links: []Link{
+			{Id: "A#B", Source: "A", Target: "B", Type: LinkFinishToStart},
+			{Id: "A#C", Source: "A", Target: "C", Type: LinkStartToStart, Lag: 2},
+			{Id: "B#C", Source: "B", Target: "C", Type: LinkFinishToStart, Lag: 1},
+		},
+	}
+
+	data, err := exportCSV(plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tasks, err := parseImport("", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string][]importLink{
+		"A": {{"B", LinkFinishToStart, 0}, {"C", LinkStartToStart, 2}},
+		"B": {{"C", LinkFinishToStart, 1}},
+		"C": nil,
+	}
+	for _, task := range tasks {
+		if !reflect.DeepEqual(task.successors, expected[task.key]) {
+			t.Errorf("Expected the successors of %s to be %+v, got %+v",
+				task.key, expected[task.key], task.successors)
+		}
+	}
+}
+
+// The state stays accessible while the tasks are being created
+func TestImportReleasesTheLock(t *testing.T) {
+	f := newFakeConduit(t)
+	sm := testStateManager(t, f, map[string]map[string]*PTask{"P": testTasks()})
+
+	created := 0
+	f.handle("maniphest.edit", func(params json.RawMessage) (interface{}, error) {
+		done := make(chan bool)
+		go func() {
+			sm.Projects()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			return nil, fmt.Errorf("The state is locked")
+		}
+
+		created++
+		phid := fmt.Sprintf("PHID-TASK-%d", created)
+		return map[string]interface{}{"object": map[string]string{"phid": phid}}, nil
+	})
+
+	data := "id,name,successors\n1,First,2\n2,Second,\n"
+	report, err := sm.Import("P", FormatCSV, []byte(data), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Created) != 2 || len(report.Steps) != 3 {
+		t.Errorf("Expected 2 tasks and 3 steps, got %+v", report)
+	}
+}
+
+// What the MS Project export writes, the import reads back: the hierarchy, the
+// milestones, the progress and all four link types with their lags
+func TestImportExportedMSPDI(t *testing.T) {
+	plan := &PlanningData{
+		Data: []Task{
+			{Id: "P", Text: "Phase", Type: "project", StartDate: "2021-03-01", Duration: 6},
+			{Id: "A", Text: "Design", Type: "task", Parent: "P", StartDate: "2021-03-01", Duration: 3, Progress: 0.5},
+			{Id: "B", Text: "Build", Type: "task", Parent: "P", StartDate: "2021-03-04", Duration: 2},
+			{Id: "C", Text: "Docs", Type: "task", StartDate: "2021-03-02", Duration: 4},
+			{Id: "M", Text: "Release", Type: "milestone", StartDate: "2021-03-08"},
+			{Id: "X", Text: "Elsewhere", Type: "task", StartDate: "2021-03-01", Duration: 1, External: true},
+		},
+		Links: []Link{
+			{Id: "A#B", Source: "A", Target: "B", Type: LinkFinishToStart},
+			{Id: "A#C", Source: "A", Target: "C", Type: LinkStartToStart, Lag: 1},
+			{Id: "C#M", Source: "C", Target: "M", Type: LinkFinishToFinish, Lag: -1},
+			{Id: "B#M", Source: "B", Target: "M", Type: LinkStartToFinish, Lag: 2},
+		},
+	}
+
+	data, err := exportMSPDI("Plan", plan, testCalendar(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported, err := parseImport("", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The keys are the MSPDI UIDs, so the tasks are told apart by their names
+	names := make(map[string]string)
+	for _, task := range imported {
+		names[task.key] = task.text
+	}
+
+	type link struct {
+		target string
+		typ    string
+		lag    int
+	}
+	type task struct {
+		parent     string
+		typ        string
+		startDate  string
+		duration   int
+		progress   float32
+		successors []link
+	}
+	expected := map[string]task{
+		"Phase":   {"", "project", "", 0, 0, nil},
+		"Design":  {"Phase", "task", "2021-03-01", 3, 0.5, []link{{"Build", LinkFinishToStart, 0}, {"Docs", LinkStartToStart, 1}}},
+		"Build":   {"Phase", "task", "2021-03-04", 2, 0, []link{{"Release", LinkStartToFinish, 2}}},
+		"Docs":    {"", "task", "2021-03-02", 4, 0, []link{{"Release", LinkFinishToFinish, -1}}},
+		"Release": {"", "milestone", "2021-03-08", 0, 0, nil},
+	}
+
+	if len(imported) != len(expected) {
+		t.Errorf("Expected %d tasks, got %d", len(expected), len(imported))
+	}
+	for _, it := range imported {
+		got := task{names[it.parent], it.typ, it.startDate, it.duration, it.progress, nil}
+		for _, succ := range it.successors {
+			got.successors = append(got.successors, link{names[succ.target], succ.typ, succ.lag})
+		}
+		sort.Slice(got.successors, func(i, j int) bool {
+			return got.successors[i].target < got.successors[j].target
+		})
+		if !reflect.DeepEqual(got, expected[it.text]) {
+			t.Errorf("Expected %s to be imported as %+v, got %+v", it.text, expected[it.text], got)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+//------------------------------------------------------------------------------
+// Copyright (C) 2021 Daedalean AG
+//
+// This file is part of PGantt.
+//
+// PGantt is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// PGantt is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with PGantt.  If not, see <https://www.gnu.org/licenses/>.
+//------------------------------------------------------------------------------
+
+package pgantt
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// A comment waiting to be posted. The marker identifies the reason for the
+// comment and ends up in its text, so that the comment is never posted twice,
+// not even by different instances of PGantt watching the same project.
+type notification struct {
+	Task   string
+	Marker string
+	Text   string
+}
+
+// The notifier decides what to comment on while the state is locked, and posts
+// the comments later, from the polling goroutine, so that the slow Conduit
+// calls never hold up the rest of PGantt
+type notifier struct {
+	phab    *Phabricator
+	cal     *Calendar
+	opts    *NotifierOpts
+	starts  map[string]int          // Start dates the slips are measured from, kept in the cache
+	m       sync.Mutex              // Guards the fields below
+	done    map[string]bool         // Markers known to be on the tasks already
+	pending map[string]notification // Keyed by marker
+	posted  []time.Time             // When the comments of the last hour were posted
+}
+
+func newNotifier(phab *Phabricator, cal *Calendar, opts *NotifierOpts, starts map[string]int) *notifier {
+	return &notifier{
+		phab:    phab,
+		cal:     cal,
+		opts:    opts,
+		starts:  starts,
+		done:    make(map[string]bool),
+		pending: make(map[string]notification),
+	}
+}
+
+func notificationMarker(kind, date string) string {
+	return fmt.Sprintf("pgantt:%s:%s", kind, date)
+}
+
+func notificationText(text, marker string) string {
+	return fmt.Sprintf("%s\n\n//Posted by PGantt (%s)//", text, marker)
+}
+
+// Look for the open tasks that should have been finished by now and for the
+// ones whose start moved later by more than the threshold, and queue the
+// comments about them. Must be called with the state locked. Reports whether
+// the start dates the slips are measured from have changed.
+func (n *notifier) check(tasks map[string]*PTask, today int) bool {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	changed := false
+	forget := func(id string) {
+		if _, ok := n.starts[id]; ok {
+			delete(n.starts, id)
+			changed = true
+		}
+	}
+
+	for id, ptask := range tasks {
+		task := &ptask.Task
+		if !task.Open || task.Type == "project" {
+			forget(id)
+			continue
+		}
+
+		last, ok := dueDay(task, n.cal)
+		if !ok {
+			forget(id)
+			continue
+		}
+
+		if last < today && task.Progress < 1 {
+			due := formatDay(last)
+			marker := notificationMarker("overdue", due)
+			text := fmt.Sprintf("This task was due on %s, but it is still open and %d%% done. "+
+				"Please update its progress or its schedule.",
+				due, int(math.Round(float64(task.Progress)*100)))
+			n.queue(notification{id, marker, notificationText(text, marker)})
+		}
+
+		// The slips are measured from the earliest start date seen since the
+		// last comment, so that a task postponed a little at a time gets
+		// noticed too
+		start, _ := parseDay(task.StartDate)
+		from, known := n.starts[id]
+		if !known || start < from {
+			n.starts[id] = start
+			changed = true
+			continue
+		}
+
+		slip := n.cal.Workdays(from, start, task.Owner)
+		if slip > n.opts.SlipThreshold {
+			marker := notificationMarker("slip", task.StartDate)
+			text := fmt.Sprintf("The start of this task moved from %s to %s, by %d working days. "+
+				"Its successors may need to be rescheduled.", formatDay(from), task.StartDate, slip)
+			n.queue(notification{id, marker, notificationText(text, marker)})
+			n.starts[id] = start
+			changed = true
+		}
+	}
+
+	// The tasks that have left the followed projects are forgotten too
+	for id := range n.starts {
+		if _, ok := tasks[id]; !ok {
+			forget(id)
+		}
+	}
+
+	// Nobody needs to hear about the tasks that have been closed or removed
+	// in the meantime
+	for key, notif := range n.pending {
+		if ptask, ok := tasks[notif.Task]; !ok || !ptask.Task.Open {
+			delete(n.pending, key)
+		}
+	}
+
+	return changed
+}
+
+func (n *notifier) queue(notif notification) {
+	key := notif.Task + " " + notif.Marker
+	if !n.done[key] {
+		n.pending[key] = notif
+	}
+}
+
+// Post the pending comments as far as the rate limit allows. Must be called
+// without the state locked.
+func (n *notifier) flush() {
+	tried := make(map[string]bool)
+	for {
+		key, notif, ok := n.next(tried)
+		if !ok {
+			return
+		}
+		tried[key] = true
+
+		posted, err := n.post(notif)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+
+		n.m.Lock()
+		if posted {
+			n.posted = append(n.posted, time.Now())
+		}
+		n.done[key] = true
+		delete(n.pending, key)
+		n.m.Unlock()
+	}
+}
+
+// The first pending comment not tried yet, unless the rate limit has been
+// reached
+func (n *notifier) next(tried map[string]bool) (string, notification, bool) {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	cutoff := time.Now().Add(-time.Hour)
+	for len(n.posted) != 0 && n.posted[0].Before(cutoff) {
+		n.posted = n.posted[1:]
+	}
+
+	keys := make([]string, 0, len(n.pending))
+	for key := range n.pending {
+		if !tried[key] {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return "", notification{}, false
+	}
+
+	if len(n.posted) >= n.opts.MaxPerHour {
+		log.Debugf("Notification rate limit reached, %d comments postponed", len(keys))
+		return "", notification{}, false
+	}
+
+	sort.Strings(keys)
+	return keys[0], n.pending[keys[0]], true
+}
+
+// Comment on the task unless it already carries the marker. Reports whether
+// the comment was posted.
+func (n *notifier) post(notif notification) (bool, error) {
+	comments, err := n.phab.TaskComments(notif.Task)
+	if err != nil {
+		return false, fmt.Errorf("Cannot fetch the comments of %q: %s", notif.Task, err)
+	}
+
+	for _, comment := range comments {
+		if strings.Contains(comment, notif.Marker) {
+			return false, nil
+		}
+	}
+
+	req := EditRequest{}
+	req.SetObjectId(notif.Task)
+	req.AddComment(notif.Text)
+	if _, err := n.phab.EditTask(&req); err != nil {
+		return false, fmt.Errorf("Cannot comment on %q: %s", notif.Task, err)
+	}
+	log.Infof("Posted %s on %q", notif.Marker, notif.Task)
+	return true, nil
+}
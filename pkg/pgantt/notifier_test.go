@@ -0,0 +1,255 @@
+//------------------------------------------------------------------------------
+// Copyright (C) 2021 Daedalean AG
+//
+// This file is part of PGantt.
+//
+// PGantt is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// PGantt is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with PGantt.  If not, see <https://www.gnu.org/licenses/>.
+//------------------------------------------------------------------------------
+
+package pgantt
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// The comments posted with maniphest.edit, served back by transaction.search
+type commentLog struct {
+	m        sync.Mutex
+	comments map[string][]string
+}
+
+func (l *commentLog) of(task string) []string {
+	l.m.Lock()
+	defer l.m.Unlock()
+	return append([]string{}, l.comments[task]...)
+}
+
+func (f *fakeConduit) handleComments() *commentLog {
+	l := &commentLog{comments: make(map[string][]string)}
+
+	f.handle("maniphest.edit", func(params json.RawMessage) (interface{}, error) {
+		var req EditRequest
+		if err := json.Unmarshal(params, &req); err != nil {
+			return nil, err
+		}
+		l.m.Lock()
+		defer l.m.Unlock()
+		for _, tr := range req.Transactions {
+			if tr.Type == "comment" {
+				l.comments[req.ObjectIdentifier] = append(l.comments[req.ObjectIdentifier], tr.Value.(string))
+			}
+		}
+		return map[string]interface{}{"object": map[string]string{"phid": req.ObjectIdentifier}}, nil
+	})
+
+	f.handle("transaction.search", func(params json.RawMessage) (interface{}, error) {
+		var req TransactionSearchRequest
+		if err := json.Unmarshal(params, &req); err != nil {
+			return nil, err
+		}
+		l.m.Lock()
+		defer l.m.Unlock()
+		data := []interface{}{}
+		for _, text := range l.comments[req.ObjectIdentifier] {
+			data = append(data, map[string]interface{}{
+				"type":     "comment",
+				"comments": []interface{}{map[string]interface{}{"content": map[string]string{"raw": text}}},
+			})
+		}
+		return map[string]interface{}{
+			"data":   data,
+			"cursor": map[string]interface{}{"after": nil},
+		}, nil
+	})
+
+	return l
+}
+
+func testNotifier(t testing.TB, f *fakeConduit, starts map[string]int) *notifier {
+	opts := NewOpts().PGantt.Notifier
+	return newNotifier(f.phabricator(t), testCalendar(t), &opts, starts)
+}
+
+func testDay(t testing.TB, date string) int {
+	day, err := parseDay(date)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return day
+}
+
+func TestNotifierOverdue(t *testing.T) {
+	f := newFakeConduit(t)
+	comments := f.handleComments()
+	today := testDay(t, "2021-03-10")
+
+	late := testTask("A", "2021-03-01", 3)
+	late.Task.Progress = 0.5
+	done := testTask("B", "2021-03-01", 3)
+	done.Task.Progress = 1
+	milestone := testTask("C", "2021-03-09", 0)
+	milestone.Task.Type = "milestone"
+	tasks := testTasks(late, done, milestone, testTask("D", "2021-03-08", 5))
+
+	n := testNotifier(t, f, make(map[string]int))
+	n.check(tasks, today)
+	n.flush()
+
+	for _, id := range []string{"B", "D"} {
+		if len(comments.of(id)) != 0 {
+			t.Errorf("Unexpected comment on %s: %v", id, comments.of(id))
+		}
+	}
+	for id, marker := range map[string]string{"A": "pgantt:overdue:2021-03-03", "C": "pgantt:overdue:2021-03-09"} {
+		if c := comments.of(id); len(c) != 1 || !strings.Contains(c[0], marker) {
+			t.Errorf("Expected a comment with %s on %s, got %v", marker, id, c)
+		}
+	}
+
+	// Known to be done already
+	f.reset()
+	n.check(tasks, today+1)
+	n.flush()
+	if calls := f.callCount("transaction.search"); calls != 0 {
+		t.Errorf("Expected no calls, got %d", calls)
+	}
+
+	// Found on the task after a restart
+	n = testNotifier(t, f, make(map[string]int))
+	n.check(tasks, today+1)
+	n.flush()
+	if c := comments.of("A"); len(c) != 1 {
+		t.Errorf("The comment was posted again: %v", c)
+	}
+	if calls := f.callCount("transaction.search"); calls != 2 {
+		t.Errorf("Expected the comments of both tasks to be checked, got %d calls", calls)
+	}
+	if len(n.pending) != 0 {
+		t.Errorf("Comments left pending: %+v", n.pending)
+	}
+}
+
+func TestNotifierSlip(t *testing.T) {
+	f := newFakeConduit(t)
+	comments := f.handleComments()
+	today := testDay(t, "2021-02-01")
+
+	starts := make(map[string]int)
+	n := testNotifier(t, f, starts)
+	tasks := testTasks(testTask("A", "2021-03-01", 1))
+
+	steps := []struct {
+		start    string
+		changed  bool
+		comments int
+	}{
+		{"2021-03-01", true, 0},
+		// Within the threshold of 5 working days
+		{"2021-03-05", false, 0},
+		// 6 working days later than the first start
+		{"2021-03-09", true, 1},
+		// Moving earlier only resets the reference
+		{"2021-03-08", true, 1},
+		{"2021-03-08", false, 1},
+	}
+
+	for _, step := range steps {
+		tasks["A"].Task.StartDate = step.start
+		if changed := n.check(tasks, today); changed != step.changed {
+			t.Errorf("%s: expected changed to be %v", step.start, step.changed)
+		}
+		n.flush()
+		if c := comments.of("A"); len(c) != step.comments {
+			t.Fatalf("%s: expected %d comments, got %v", step.start, step.comments, c)
+		}
+	}
+
+	if c := comments.of("A"); !strings.Contains(c[0], "pgantt:slip:2021-03-09") ||
+		!strings.Contains(c[0], "from 2021-03-01 to 2021-03-09, by 6 working days") {
+		t.Errorf("Unexpected comment: %s", c[0])
+	}
+
+	// The reference survives a restart
+	n = testNotifier(t, f, starts)
+	tasks["A"].Task.StartDate = "2021-03-17"
+	n.check(tasks, today)
+	n.flush()
+	if c := comments.of("A"); len(c) != 2 || !strings.Contains(c[1], "from 2021-03-08 to 2021-03-17") {
+		t.Errorf("Expected the slip since the restart to be reported, got %v", c)
+	}
+
+	// The closed tasks are forgotten
+	tasks["A"].Task.Open = false
+	if !n.check(tasks, today) || len(starts) != 0 {
+		t.Errorf("The closed task is still tracked: %v", starts)
+	}
+}
+
+func TestNotifierRateLimit(t *testing.T) {
+	f := newFakeConduit(t)
+	comments := f.handleComments()
+	today := testDay(t, "2021-03-10")
+
+	tasks := testTasks(testTask("A", "2021-03-01", 1), testTask("B", "2021-03-01", 1))
+	n := testNotifier(t, f, make(map[string]int))
+	n.opts.MaxPerHour = 1
+
+	n.check(tasks, today)
+	n.flush()
+	n.flush()
+	if len(comments.of("A")) != 1 || len(comments.of("B")) != 0 {
+		t.Errorf("Expected only A to be commented on, got %v and %v", comments.of("A"), comments.of("B"))
+	}
+	if len(n.pending) != 1 {
+		t.Errorf("Expected the comment on B to be postponed: %+v", n.pending)
+	}
+
+	// B was closed before its turn came
+	tasks["B"].Task.Open = false
+	n.check(tasks, today)
+	if len(n.pending) != 0 {
+		t.Errorf("The comment on a closed task is still pending: %+v", n.pending)
+	}
+}
+
+func TestNotifierOpts(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(notifier string) {
+		config := "hosts:\n  https://phab/api/:\n    token: api-test\npgantt:\n  notifier: " + notifier + "\n"
+		if err := ioutil.WriteFile(fileName, []byte(config), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("{enabled: true}")
+	opts := NewOpts()
+	if err := opts.LoadYaml(fileName); err != nil {
+		t.Fatal(err)
+	}
+	if opts.PGantt.Notifier.MaxPerHour != 10 {
+		t.Errorf("Expected the default rate limit, got %d", opts.PGantt.Notifier.MaxPerHour)
+	}
+
+	for _, notifier := range []string{"{enabled: true, max_per_hour: 0}", "{slip_threshold: -1}"} {
+		write(notifier)
+		if err := NewOpts().LoadYaml(fileName); err == nil {
+			t.Errorf("Accepted %s", notifier)
+		}
+	}
+}
@@ -27,14 +27,43 @@ import (
 	"github.com/ghodss/yaml"
 )
 
+// Deleting a task from the chart either closes it as invalid or removes it
+// from the project
+const (
+	DeleteCloseInvalid = "invalid"
+	DeleteRemove       = "remove"
+)
+
 type HostOpts struct {
 	Token string `json:"token"`
 }
 
+type CalendarOpts struct {
+	Weekend       []int               `json:"weekend"`        // Days of the week off work, 0 is Sunday
+	Holidays      []string            `json:"holidays"`       // Public holidays, as dates or date/date ranges
+	HolidayFiles  []string            `json:"holiday_files"`  // iCalendar files listing the public holidays
+	Vacations     map[string][]string `json:"vacations"`      // Days off by username, as dates or date/date ranges
+	VacationFiles map[string]string   `json:"vacation_files"` // iCalendar files listing the days off by username
+}
+
+type NotifierOpts struct {
+	Enabled       bool `json:"enabled"`        // Comment on the overdue and slipping tasks
+	SlipThreshold int  `json:"slip_threshold"` // Working days a start date may move later without a comment
+	MaxPerHour    int  `json:"max_per_hour"`   // Upper bound on the number of comments posted in an hour
+}
+
 type PGanttOpts struct {
-	Port         int      `json:"port"`          // Port to serve the on
-	Projects     []string `json:"projects"`      // List of projects to be handled
-	PollInterval int      `json:"poll_interval"` // How often to pool Phabricator for changes in seconds
+	Port             int                `json:"port"`               // Port to serve the on
+	Projects         []string           `json:"projects"`           // List of projects to be handled
+	PollInterval     int                `json:"poll_interval"`      // How often to pool Phabricator for changes in seconds
+	FullSyncInterval int                `json:"full_sync_interval"` // How often to re-examine all the tasks in seconds
+	AutoSchedule     bool               `json:"auto_schedule"`      // Move the successors of the edited tasks automatically
+	CacheFile        string             `json:"cache_file"`         // Where to keep the task data between runs, empty to disable
+	Capacity         map[string]float64 `json:"capacity"`           // How many tasks a person can work on in parallel, by username
+	Calendar         CalendarOpts       `json:"calendar"`           // Working days used to count the durations
+	DeleteAction     string             `json:"delete_action"`      // What deleting a task does: "invalid" or "remove"
+	BaselineDir      string             `json:"baseline_dir"`       // Where to keep the saved baselines of the plans
+	Notifier         NotifierOpts       `json:"notifier"`           // Comments posted to the tasks that need attention
 }
 
 type Opts struct {
@@ -48,7 +77,13 @@ func NewOpts() (opts *Opts) {
 	opts = new(Opts)
 	opts.PGantt.Port = 9999
 	opts.PGantt.PollInterval = 10
+	opts.PGantt.FullSyncInterval = 600
 	opts.PGantt.Projects = []string{}
+	opts.PGantt.Capacity = map[string]float64{}
+	opts.PGantt.Calendar.Weekend = []int{0, 6}
+	opts.PGantt.DeleteAction = DeleteCloseInvalid
+	opts.PGantt.Notifier.SlipThreshold = 5
+	opts.PGantt.Notifier.MaxPerHour = 10
 	return
 }
 
@@ -78,5 +113,17 @@ func (opts *Opts) LoadYaml(fileName string) error {
 	opts.PhabricatorUri = host
 	opts.ApiKey = token
 
+	if opts.PGantt.DeleteAction != DeleteCloseInvalid && opts.PGantt.DeleteAction != DeleteRemove {
+		return fmt.Errorf("Unknown delete action %q in %s", opts.PGantt.DeleteAction, fileName)
+	}
+
+	if opts.PGantt.Notifier.Enabled && opts.PGantt.Notifier.MaxPerHour <= 0 {
+		return fmt.Errorf("The notifier needs a positive max_per_hour in %s", fileName)
+	}
+
+	if opts.PGantt.Notifier.SlipThreshold < 0 {
+		return fmt.Errorf("Negative notifier slip_threshold in %s", fileName)
+	}
+
 	return nil
 }
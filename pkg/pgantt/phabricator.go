@@ -24,6 +24,7 @@ import (
 	"fmt"
 	"net/url"
 	"reflect"
+	"sort"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -50,6 +51,7 @@ type PTask struct {
 type PLinkData struct {
 	Target string `json:"target"`
 	Type   string `json:"type"`
+	Lag    int    `json:"lag,omitempty"`
 }
 
 type Transaction struct {
@@ -63,12 +65,57 @@ type EditRequest struct {
 	Transactions     []Transaction `json:"transactions"`
 }
 
+type EdgeSearchRequest struct {
+	requests.Request
+	SourcePHIDs []string `json:"sourcePHIDs"`
+	Types       []string `json:"types"`
+	After       string   `json:"after,omitempty"`
+}
+
+type EdgeSearchResponse struct {
+	Data []struct {
+		SourcePHID      string `json:"sourcePHID"`
+		EdgeType        string `json:"edgeType"`
+		DestinationPHID string `json:"destinationPHID"`
+	} `json:"data"`
+	Cursor struct {
+		After string `json:"after"`
+	} `json:"cursor"`
+}
+
 type EditResponse struct {
 	Object struct {
 		Phid string `json:"phid"`
 	} `json:"object"`
 }
 
+type TransactionSearchRequest struct {
+	requests.Request
+	ObjectIdentifier string `json:"objectIdentifier"`
+	After            string `json:"after,omitempty"`
+}
+
+type TransactionSearchResponse struct {
+	Data []struct {
+		Type     string `json:"type"`
+		Comments []struct {
+			Content struct {
+				Raw string `json:"raw"`
+			} `json:"content"`
+		} `json:"comments"`
+	} `json:"data"`
+	Cursor struct {
+		After string `json:"after"`
+	} `json:"cursor"`
+}
+
+type PhrictionRequest struct {
+	requests.Request
+	Slug    string `json:"slug"`
+	Title   string `json:"title"`
+	Content string `json:"content"`
+}
+
 func (r *EditRequest) SetObjectId(phid string) {
 	r.ObjectIdentifier = phid
 }
@@ -89,6 +136,14 @@ func (r *EditRequest) SetProject(phid string) {
 	r.Transactions = append(r.Transactions, Transaction{"projects.set", []string{phid}})
 }
 
+func (r *EditRequest) RemoveProject(phid string) {
+	r.Transactions = append(r.Transactions, Transaction{"projects.remove", []string{phid}})
+}
+
+func (r *EditRequest) SetStatus(status string) {
+	r.Transactions = append(r.Transactions, Transaction{"status", status})
+}
+
 func (r *EditRequest) SetColumn(phid string) {
 	r.Transactions = append(r.Transactions, Transaction{"column", []string{phid}})
 }
@@ -97,6 +152,14 @@ func (r *EditRequest) SetTitle(title string) {
 	r.Transactions = append(r.Transactions, Transaction{"title", title})
 }
 
+func (r *EditRequest) SetOwner(phid string) {
+	if phid == "" {
+		r.Transactions = append(r.Transactions, Transaction{"owner", nil})
+	} else {
+		r.Transactions = append(r.Transactions, Transaction{"owner", phid})
+	}
+}
+
 func (r *EditRequest) SetStartDate(date int64) {
 	r.Transactions = append(r.Transactions, Transaction{"custom.daedalean.start_date", float64(date)})
 }
@@ -122,6 +185,10 @@ func (r *EditRequest) SetSuccessors(links []PLinkData) {
 	r.Transactions = append(r.Transactions, Transaction{"custom.daedalean.successors", string(data)})
 }
 
+func (r *EditRequest) AddComment(text string) {
+	r.Transactions = append(r.Transactions, Transaction{"comment", text})
+}
+
 func (r *EditRequest) SetType(typ string) {
 	phTyp := "daedalean:task"
 	if typ == "milestone" {
@@ -249,24 +316,46 @@ func (p *Phabricator) verifyCustomFields(fields map[string]interface{}) {
 	}
 	for _, name := range fieldNames {
 		if _, ok := fields[name]; !ok {
-			log.Fatalf("Task field %q missing. Please go to " +
-				"https://github.com/daedaleanai/pgantt for instructions on how" +
-				"to configure Phabricator")
+			log.Fatalf("Task field %q missing. Please go to "+
+				"https://github.com/daedaleanai/pgantt for instructions on how "+
+				"to configure Phabricator", name)
 		}
 	}
 }
 
-func (p *Phabricator) SyncTasksForProject(phid string, tasks map[string]*PTask) (map[string]*PTask, error) {
+// Fetch the tasks of the project that changed since the last sync. If full is
+// set, all the tasks of the project are examined instead of just the ones
+// modified after the newest task we know about.
+func (p *Phabricator) SyncTasksForProject(phid string, tasks map[string]*PTask, full bool) (map[string]*PTask, error) {
 	if tasks == nil {
 		tasks = make(map[string]*PTask)
 	}
 
+	constraints := map[string]interface{}{
+		"projects": []string{phid},
+	}
+
+	if !full {
+		var highWater uint64
+		for _, ptask := range tasks {
+			if ptask.Mtime > highWater {
+				highWater = ptask.Mtime
+			}
+		}
+
+		// The constraint is inclusive, so the tasks modified within the
+		// same second as the newest known one are examined again
+		if highWater != 0 {
+			constraints["modifiedStart"] = highWater
+		}
+	}
+
+	updated := []string{}
+	seen := make(map[string]bool)
 	after := ""
 	for {
 		req := requests.SearchRequest{
-			Constraints: map[string]interface{}{
-				"projects": []string{phid},
-			},
+			Constraints: constraints,
 			Attachments: map[string]bool{
 				"columns": true,
 			},
@@ -280,6 +369,7 @@ func (p *Phabricator) SyncTasksForProject(phid string, tasks map[string]*PTask)
 		for _, el := range res.Data {
 			p.verifyCustomFields(el.Fields)
 			taskPhid := el.PHID
+			seen[taskPhid] = true
 			mtime := uint64(el.Fields["dateModified"].(float64))
 			update := false
 
@@ -292,10 +382,12 @@ func (p *Phabricator) SyncTasksForProject(phid string, tasks map[string]*PTask)
 				log.Debugf("Updating cached task %q", taskPhid)
 				ptask := &PTask{}
 				tasks[taskPhid] = ptask
+				updated = append(updated, taskPhid)
 				ptask.IsLeaf = true
 				ptask.Links = make(map[string]*Link)
 				ptask.Mtime = mtime
 				ptask.Task.Id = taskPhid
+				ptask.Task.Version = mtime
 				ptask.Task.Text = el.Fields["name"].(string)
 				ptask.Task.Open = el.Fields["status"].(map[string]interface{})["value"].(string) == "open"
 				board := el.Attachments["columns"]["boards"].(map[string]interface{})[phid]
@@ -308,6 +400,10 @@ func (p *Phabricator) SyncTasksForProject(phid string, tasks map[string]*PTask)
 				ptask.Task.Column = col["phid"].(string)
 				ptask.Task.Url = fmt.Sprintf("%s/T%d", p.endpoint, el.ID)
 
+				if el.Fields["ownerPHID"] != nil {
+					ptask.Task.Owner = el.Fields["ownerPHID"].(string)
+				}
+
 				ptask.Task.Unscheduled = true
 				if el.Fields["custom.daedalean.scheduled"] != nil {
 					ptask.Task.Unscheduled = !el.Fields["custom.daedalean.scheduled"].(bool)
@@ -334,14 +430,7 @@ func (p *Phabricator) SyncTasksForProject(phid string, tasks map[string]*PTask)
 					if err := json.Unmarshal([]byte(data), &linkData); err != nil {
 						log.Errorf("Cannot unmarshal successors in task %q titled %q: %s", taskPhid, ptask.Task.Text, err)
 					} else {
-						for _, ld := range linkData {
-							link := &Link{}
-							link.Source = taskPhid
-							link.Target = ld.Target
-							link.Type = ld.Type
-							link.Id = generateLinkId(link)
-							ptask.Links[link.Id] = link
-						}
+						ptask.Links = successorLinks(taskPhid, linkData)
 					}
 				}
 
@@ -356,22 +445,6 @@ func (p *Phabricator) SyncTasksForProject(phid string, tasks map[string]*PTask)
 					}
 				}
 
-				// Find out who the parent is
-				req := requests.SearchRequest{
-					Constraints: map[string]interface{}{
-						"projects":   []string{phid},
-						"subtaskIDs": []int{el.ID},
-					},
-				}
-
-				var res responses.SearchResponse
-				if err := p.c.Call("maniphest.search", &req, &res); err != nil {
-					return nil, err
-				}
-
-				if len(res.Data) != 0 {
-					ptask.Task.Parent = res.Data[0].PHID
-				}
 			}
 		}
 
@@ -381,6 +454,33 @@ func (p *Phabricator) SyncTasksForProject(phid string, tasks map[string]*PTask)
 		}
 	}
 
+	// Find out who the parents of the updated tasks are. Only the parents
+	// belonging to the same project count.
+	parents, err := p.TaskParents(updated)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, taskPhid := range updated {
+		for _, parent := range parents[taskPhid] {
+			if _, ok := tasks[parent]; ok {
+				tasks[taskPhid].Task.Parent = parent
+				break
+			}
+		}
+	}
+
+	// A full scan sees every task that is still in the project, so the ones
+	// that have not been seen were removed from it, deleted, or made
+	// invisible to us
+	if full {
+		pruneTasks(tasks, seen)
+	}
+
+	for _, task := range tasks {
+		task.IsLeaf = true
+	}
+
 	for _, task := range tasks {
 		if task.Task.Parent != "" {
 			tasks[task.Task.Parent].IsLeaf = false
@@ -400,6 +500,73 @@ func (p *Phabricator) SyncTasksForProject(phid string, tasks map[string]*PTask)
 	return tasks, nil
 }
 
+// Fetch the parents of the given tasks using the edge search, so that the
+// whole hierarchy is resolved in a handful of calls
+func (p *Phabricator) TaskParents(phids []string) (map[string][]string, error) {
+	const chunkSize = 100
+
+	parents := make(map[string][]string)
+	for len(phids) != 0 {
+		chunk := phids
+		if len(chunk) > chunkSize {
+			chunk = chunk[:chunkSize]
+		}
+		phids = phids[len(chunk):]
+
+		after := ""
+		for {
+			req := EdgeSearchRequest{
+				SourcePHIDs: chunk,
+				Types:       []string{"task.parent"},
+				After:       after,
+			}
+			var res EdgeSearchResponse
+			if err := p.c.Call("edge.search", &req, &res); err != nil {
+				return nil, err
+			}
+
+			for _, edge := range res.Data {
+				parents[edge.SourcePHID] = append(parents[edge.SourcePHID], edge.DestinationPHID)
+			}
+
+			after = res.Cursor.After
+			if after == "" {
+				break
+			}
+		}
+	}
+
+	for phid := range parents {
+		sort.Strings(parents[phid])
+	}
+	return parents, nil
+}
+
+// Drop the tasks that are not in the keep set together with the parent and
+// link references to them
+func pruneTasks(tasks map[string]*PTask, keep map[string]bool) {
+	removed := make(map[string]bool)
+	for id, ptask := range tasks {
+		if !keep[id] {
+			log.Infof("Task %q titled %q is gone, removing it from the cache", id, ptask.Task.Text)
+			removed[id] = true
+			delete(tasks, id)
+		}
+	}
+
+	if len(removed) == 0 {
+		return
+	}
+
+	// The links are pruned by the state manager, because their targets may
+	// live in other projects
+	for _, ptask := range tasks {
+		if removed[ptask.Task.Parent] {
+			ptask.Task.Parent = ""
+		}
+	}
+}
+
 func (p *Phabricator) EditTask(req *EditRequest) (string, error) {
 	if req.ObjectIdentifier == "" {
 		for _, tr := range req.Transactions {
@@ -419,6 +586,34 @@ func (p *Phabricator) EditTask(req *EditRequest) (string, error) {
 	return res.Object.Phid, nil
 }
 
+// Fetch the raw text of all the comments made on the task
+func (p *Phabricator) TaskComments(phid string) ([]string, error) {
+	comments := []string{}
+	after := ""
+	for {
+		req := TransactionSearchRequest{ObjectIdentifier: phid, After: after}
+		var res TransactionSearchResponse
+		if err := p.c.Call("transaction.search", &req, &res); err != nil {
+			return nil, err
+		}
+
+		for _, tr := range res.Data {
+			if tr.Type != "comment" {
+				continue
+			}
+			for _, comment := range tr.Comments {
+				comments = append(comments, comment.Content.Raw)
+			}
+		}
+
+		after = res.Cursor.After
+		if after == "" {
+			break
+		}
+	}
+	return comments, nil
+}
+
 func (p *Phabricator) Users() ([]User, error) {
 	after := ""
 	users := []User{}
@@ -455,6 +650,33 @@ func (p *Phabricator) Users() ([]User, error) {
 	return users, nil
 }
 
+// Create the wiki document at the given path, or update it if it's already
+// there
+func (p *Phabricator) PublishDocument(slug, title, content string) error {
+	req := requests.SearchRequest{
+		Constraints: map[string]interface{}{
+			"paths": []string{slug},
+		},
+	}
+	var res responses.SearchResponse
+	if err := p.c.Call("phriction.document.search", &req, &res); err != nil {
+		return err
+	}
+
+	method := "phriction.create"
+	if len(res.Data) != 0 {
+		method = "phriction.edit"
+	}
+
+	log.Debugf("Publishing %q to Phriction using %s", slug, method)
+	docReq := PhrictionRequest{Slug: slug, Title: title, Content: content}
+	var docRes interface{}
+	if err := p.c.Call(method, &docReq, &docRes); err != nil {
+		return fmt.Errorf("Cannot publish %q to Phriction: %s", slug, err)
+	}
+	return nil
+}
+
 func NewPhabricator(endpoint, key string) (*Phabricator, error) {
 	u, err := url.Parse(endpoint)
 	if err != nil {
@@ -0,0 +1,434 @@
+//------------------------------------------------------------------------------
+// Copyright (C) 2021 Daedalean AG
+//
+// This file is part of PGantt.
+//
+// PGantt is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// PGantt is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with PGantt.  If not, see <https://www.gnu.org/licenses/>.
+//------------------------------------------------------------------------------
+
+package pgantt
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/thought-machine/gonduit"
+	"github.com/thought-machine/gonduit/core"
+	"github.com/thought-machine/gonduit/requests"
+	"github.com/thought-machine/gonduit/responses"
+)
+
+// Minimal Conduit server answering the methods registered with handle and
+// counting the calls
+type fakeConduit struct {
+	server   *httptest.Server
+	m        sync.Mutex
+	calls    map[string]int
+	handlers map[string]func(params json.RawMessage) (interface{}, error)
+}
+
+func newFakeConduit(t testing.TB) *fakeConduit {
+	f := &fakeConduit{
+		calls:    make(map[string]int),
+		handlers: make(map[string]func(json.RawMessage) (interface{}, error)),
+	}
+
+	f.handle("conduit.getcapabilities", func(json.RawMessage) (interface{}, error) {
+		return map[string][]string{
+			"authentication": {"token"},
+			"input":          {"json", "urlencoded"},
+			"output":         {"json"},
+		}, nil
+	})
+
+	f.server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeConduit) handle(method string, handler func(params json.RawMessage) (interface{}, error)) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.handlers[method] = handler
+}
+
+func (f *fakeConduit) serve(w http.ResponseWriter, r *http.Request) {
+	method := r.URL.Path[len("/api/"):]
+
+	f.m.Lock()
+	f.calls[method]++
+	handler, ok := f.handlers[method]
+	f.m.Unlock()
+
+	resp := map[string]interface{}{"result": nil, "error_code": nil, "error_info": nil}
+	if !ok {
+		resp["error_code"] = "ERR-CONDUIT-CALL"
+		resp["error_info"] = fmt.Sprintf("Unknown method %q", method)
+	} else if result, err := handler(json.RawMessage(r.FormValue("params"))); err != nil {
+		resp["error_code"] = "ERR-CONDUIT-CORE"
+		resp["error_info"] = err.Error()
+	} else {
+		resp["result"] = result
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (f *fakeConduit) callCount(method string) int {
+	f.m.Lock()
+	defer f.m.Unlock()
+	return f.calls[method]
+}
+
+func (f *fakeConduit) reset() {
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.calls = make(map[string]int)
+}
+
+func (f *fakeConduit) phabricator(t testing.TB) *Phabricator {
+	conn, err := gonduit.Dial(f.server.URL, &core.ClientOptions{APIToken: "api-test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Phabricator{c: conn, endpoint: f.server.URL}
+}
+
+// Serve edge.search for the given child to parent edges the way Phabricator
+// does: at most 100 source PHIDs per call and 100 edges per page
+func (f *fakeConduit) handleEdges(parents map[string][]string) {
+	const limit = 100
+	f.handle("edge.search", func(params json.RawMessage) (interface{}, error) {
+		var req EdgeSearchRequest
+		if err := json.Unmarshal(params, &req); err != nil {
+			return nil, err
+		}
+		if len(req.SourcePHIDs) > limit {
+			return nil, fmt.Errorf("Too many source PHIDs: %d", len(req.SourcePHIDs))
+		}
+
+		type edge struct {
+			SourcePHID      string `json:"sourcePHID"`
+			EdgeType        string `json:"edgeType"`
+			DestinationPHID string `json:"destinationPHID"`
+		}
+		edges := []edge{}
+		for _, src := range req.SourcePHIDs {
+			for _, dst := range parents[src] {
+				edges = append(edges, edge{src, "task.parent", dst})
+			}
+		}
+
+		offset, _ := strconv.Atoi(req.After)
+		end := offset + limit
+		after := ""
+		if end < len(edges) {
+			after = strconv.Itoa(end)
+		} else {
+			end = len(edges)
+		}
+
+		return map[string]interface{}{
+			"data":   edges[offset:end],
+			"cursor": map[string]interface{}{"after": after},
+		}, nil
+	})
+}
+
+// Every task but the first one in a group of ten is a subtask of the first one
+func testHierarchy(n int) ([]string, map[string][]string) {
+	phids := make([]string, n)
+	parents := make(map[string][]string)
+	for i := range phids {
+		phids[i] = fmt.Sprintf("PHID-TASK-%04d", i)
+		if i%10 != 0 {
+			parents[phids[i]] = []string{phids[i-i%10]}
+		}
+	}
+	return phids, parents
+}
+
+func TestTaskParentsChunks(t *testing.T) {
+	f := newFakeConduit(t)
+	phab := f.phabricator(t)
+
+	tests := []struct {
+		tasks int
+		calls int
+	}{
+		{1, 1},
+		{99, 1},
+		{100, 1},
+		{101, 2},
+		{200, 2},
+		{201, 3},
+	}
+
+	for _, test := range tests {
+		t.Run(strconv.Itoa(test.tasks), func(t *testing.T) {
+			phids, expected := testHierarchy(test.tasks)
+			f.handleEdges(expected)
+			f.reset()
+
+			parents, err := phab.TaskParents(phids)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(parents, expected) {
+				t.Errorf("Expected %d parent entries, got %d", len(expected), len(parents))
+			}
+			if calls := f.callCount("edge.search"); calls != test.calls {
+				t.Errorf("Expected %d calls, got %d", test.calls, calls)
+			}
+		})
+	}
+}
+
+// The edges of a single chunk span several pages
+func TestTaskParentsPages(t *testing.T) {
+	f := newFakeConduit(t)
+	phab := f.phabricator(t)
+
+	phids := []string{}
+	expected := make(map[string][]string)
+	for i := 0; i < 50; i++ {
+		phid := fmt.Sprintf("PHID-TASK-%04d", i)
+		phids = append(phids, phid)
+		expected[phid] = []string{"PHID-TASK-A", "PHID-TASK-B", "PHID-TASK-C"}
+	}
+	f.handleEdges(expected)
+
+	parents, err := phab.TaskParents(phids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parents, expected) {
+		t.Errorf("Parents differ from the expected ones")
+	}
+	if calls := f.callCount("edge.search"); calls != 2 {
+		t.Errorf("Expected 2 calls, got %d", calls)
+	}
+}
+
+// The lag is only written when there is one, so the tasks without lags keep
+// the format the older versions understand
+func TestSuccessorsLag(t *testing.T) {
+	links := map[string]*Link{
+		"A#B": {Id: "A#B", Source: "A", Target: "B", Type: LinkFinishToStart},
+		"A#C": {Id: "A#C", Source: "A", Target: "C", Type: LinkStartToStart, Lag: -2},
+	}
+
+	req := EditRequest{}
+	req.SetSuccessors(getLinkSlice(links))
+	data := req.Transactions[0].Value.(string)
+	expected := `[{"target":"B","type":"0"},{"target":"C","type":"1","lag":-2}]`
+	if data != expected {
+		t.Errorf("Expected %s, got %s", expected, data)
+	}
+
+	linkData := []PLinkData{}
+	if err := json.Unmarshal([]byte(data), &linkData); err != nil {
+		t.Fatal(err)
+	}
+	if parsed := successorLinks("A", linkData); !reflect.DeepEqual(parsed, links) {
+		t.Errorf("Expected %+v, got %+v", links, parsed)
+	}
+
+	// Stored before the links had lags
+	linkData = []PLinkData{}
+	if err := json.Unmarshal([]byte(`[{"target":"B","type":"0"}]`), &linkData); err != nil {
+		t.Fatal(err)
+	}
+	if parsed := successorLinks("A", linkData); len(parsed) != 1 || parsed["A#B"].Lag != 0 {
+		t.Errorf("Expected a single link without a lag, got %+v", parsed)
+	}
+}
+
+// A scheduled task on the given project board as maniphest.search returns it
+func fakeTask(id int, phid, project, name string) map[string]interface{} {
+	return map[string]interface{}{
+		"id":   id,
+		"phid": phid,
+		"fields": map[string]interface{}{
+			"name":                        name,
+			"status":                      map[string]string{"value": "open"},
+			"dateModified":                1234,
+			"ownerPHID":                   nil,
+			"custom.daedalean.scheduled":  true,
+			"custom.daedalean.start_date": 1614556800,
+			"custom.daedalean.duration":   2,
+			"custom.daedalean.progress":   nil,
+			"custom.daedalean.type":       nil,
+			"custom.daedalean.successors": nil,
+		},
+		"attachments": map[string]interface{}{
+			"columns": map[string]interface{}{
+				"boards": map[string]interface{}{
+					project: map[string]interface{}{
+						"columns": []map[string]string{{"phid": "PHID-PCOL-1"}},
+					},
+				},
+			},
+		},
+	}
+}
+
+// Serve maniphest.search for the tasks of a project, 100 per page, with task
+// n+1 being phids[n]. The subtaskIDs constraint finds the parents of a task.
+func (f *fakeConduit) handleProjectTasks(project string, phids []string, parents map[string][]string) {
+	const limit = 100
+	ids := make(map[string]int)
+	for i, phid := range phids {
+		ids[phid] = i + 1
+	}
+
+	f.handle("maniphest.search", func(params json.RawMessage) (interface{}, error) {
+		var req struct {
+			Constraints struct {
+				SubtaskIDs []int `json:"subtaskIDs"`
+			} `json:"constraints"`
+			After string `json:"after"`
+		}
+		if err := json.Unmarshal(params, &req); err != nil {
+			return nil, err
+		}
+
+		data := []interface{}{}
+		if len(req.Constraints.SubtaskIDs) != 0 {
+			for _, id := range req.Constraints.SubtaskIDs {
+				for _, parent := range parents[phids[id-1]] {
+					data = append(data, fakeTask(ids[parent], parent, project, parent))
+				}
+			}
+			return map[string]interface{}{
+				"data":   data,
+				"cursor": map[string]interface{}{"after": nil},
+			}, nil
+		}
+
+		offset, _ := strconv.Atoi(req.After)
+		end := offset + limit
+		var after interface{}
+		if end < len(phids) {
+			after = strconv.Itoa(end)
+		} else {
+			end = len(phids)
+		}
+		for i := offset; i < end; i++ {
+			data = append(data, fakeTask(i+1, phids[i], project, phids[i]))
+		}
+		return map[string]interface{}{
+			"data":   data,
+			"cursor": map[string]interface{}{"after": after},
+		}, nil
+	})
+}
+
+// The way a full sync used to look up the parents: one maniphest.search with
+// the subtaskIDs constraint for every updated task. The conversion of the
+// fields is left out, it is the same in both paths.
+func syncPerTaskParents(p *Phabricator, phid string) (map[string]string, error) {
+	parents := make(map[string]string)
+	after := ""
+	for {
+		req := requests.SearchRequest{
+			Constraints: map[string]interface{}{"projects": []string{phid}},
+			Attachments: map[string]bool{"columns": true},
+			After:       after,
+		}
+		var res responses.SearchResponse
+		if err := p.c.Call("maniphest.search", &req, &res); err != nil {
+			return nil, err
+		}
+
+		for _, el := range res.Data {
+			p.verifyCustomFields(el.Fields)
+			req := requests.SearchRequest{
+				Constraints: map[string]interface{}{
+					"projects":   []string{phid},
+					"subtaskIDs": []int{el.ID},
+				},
+			}
+			var sub responses.SearchResponse
+			if err := p.c.Call("maniphest.search", &req, &sub); err != nil {
+				return nil, err
+			}
+			if len(sub.Data) != 0 {
+				parents[el.PHID] = sub.Data[0].PHID
+			}
+		}
+
+		after = res.Cursor.After
+		if after == "" {
+			break
+		}
+	}
+	return parents, nil
+}
+
+// Run a full sync of a 2000-task project with the parents looked up one task
+// at a time, the way it used to be done, and in batches
+func BenchmarkSyncTasksForProject(b *testing.B) {
+	f := newFakeConduit(b)
+	phab := f.phabricator(b)
+	phids, parents := testHierarchy(2000)
+	f.handleEdges(parents)
+	f.handleProjectTasks("PHID-PROJ-1", phids, parents)
+
+	// Both paths must agree on the hierarchy
+	perTask, err := syncPerTaskParents(phab, "PHID-PROJ-1")
+	if err != nil {
+		b.Fatal(err)
+	}
+	tasks, err := phab.SyncTasksForProject("PHID-PROJ-1", nil, true)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, phid := range phids {
+		if tasks[phid].Task.Parent != perTask[phid] {
+			b.Fatalf("Parent of %s: %q per task, %q batched", phid, perTask[phid], tasks[phid].Task.Parent)
+		}
+	}
+
+	calls := func() int {
+		return f.callCount("maniphest.search") + f.callCount("edge.search")
+	}
+
+	b.Run("per-task", func(b *testing.B) {
+		f.reset()
+		for i := 0; i < b.N; i++ {
+			if _, err := syncPerTaskParents(phab, "PHID-PROJ-1"); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ReportMetric(float64(calls())/float64(b.N), "calls/op")
+	})
+
+	b.Run("batched", func(b *testing.B) {
+		f.reset()
+		for i := 0; i < b.N; i++ {
+			if _, err := phab.SyncTasksForProject("PHID-PROJ-1", nil, true); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ReportMetric(float64(calls())/float64(b.N), "calls/op")
+	})
+}
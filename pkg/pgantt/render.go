@@ -0,0 +1,560 @@
+//------------------------------------------------------------------------------
+// Copyright (C) 2021 Daedalean AG
+//
+// This file is part of PGantt.
+//
+// PGantt is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// PGantt is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with PGantt.  If not, see <https://www.gnu.org/licenses/>.
+//------------------------------------------------------------------------------
+
+package pgantt
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"sort"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// Chart zoom levels, as the number of pixels per day
+var renderZooms = map[string]int{
+	"day":   24,
+	"week":  8,
+	"month": 3,
+}
+
+const (
+	renderGridWidth   = 260
+	renderRowHeight   = 24
+	renderScaleRow    = 20
+	renderIndent      = 12
+	renderCharWidth   = 7
+	renderMaxWidth    = 16000
+	renderMaxHeight   = 16000
+	renderMargin      = 2
+	renderArrowStub   = 8
+	renderArrowSize   = 4
+	renderZoomDefault = "week"
+)
+
+type RenderOpts struct {
+	From   string // First day shown, computed from the tasks if empty
+	To     string // Last day shown, computed from the tasks if empty
+	Zoom   string // One of day, week or month
+	Closed bool   // Include the closed tasks
+	Today  int    // Day to mark as today
+}
+
+// Drawing primitives shared by the SVG and PNG backends, drawn in the order
+// they were added to the scene
+type renderItem interface {
+	writeSVG(buf *bytes.Buffer)
+	draw(img *image.RGBA)
+}
+
+type renderRect struct {
+	x, y, w, h int
+	fill       string
+}
+
+type renderLine struct {
+	x1, y1, x2, y2 int
+	stroke         string
+}
+
+type renderPolygon struct {
+	points [][2]int
+	fill   string
+}
+
+type renderText struct {
+	x, y int
+	text string
+	fill string
+	bold bool
+}
+
+type renderScene struct {
+	width, height int
+	items         []renderItem
+}
+
+func (sc *renderScene) rect(x, y, w, h int, fill string) {
+	sc.items = append(sc.items, &renderRect{x, y, w, h, fill})
+}
+
+func (sc *renderScene) line(x1, y1, x2, y2 int, stroke string) {
+	sc.items = append(sc.items, &renderLine{x1, y1, x2, y2, stroke})
+}
+
+func (sc *renderScene) polygon(fill string, points ...[2]int) {
+	sc.items = append(sc.items, &renderPolygon{points, fill})
+}
+
+func (sc *renderScene) text(x, y int, text, fill string, bold bool) {
+	sc.items = append(sc.items, &renderText{x, y, text, fill, bold})
+}
+
+// The colours follow the default dhtmlx-gantt skin
+const (
+	renderBackground = "#ffffff"
+	renderGridLine   = "#ebebeb"
+	renderTextColor  = "#454545"
+	renderWeekend    = "#f4f7f4"
+	renderTaskColor  = "#3db9d3"
+	renderProgress   = "#2898b0"
+	renderSummary    = "#65c16f"
+	renderMilestone  = "#d33daf"
+	renderLinkColor  = "#ffa011"
+	renderToday      = "#ff5252"
+)
+
+type renderRow struct {
+	task          Task
+	level         int
+	summary       bool
+	scheduled     bool
+	start, finish int
+}
+
+// Lay the visible tasks out in the outline order, the children right after
+// their parents, sorted by the start date
+func renderRows(plan *PlanningData, cal *Calendar, closed bool) []*renderRow {
+	tasks := make(map[string]Task)
+	for _, task := range plan.Data {
+		if !task.External && (closed || task.Open) {
+			tasks[task.Id] = task
+		}
+	}
+
+	children := make(map[string][]string)
+	for id, task := range tasks {
+		parent := task.Parent
+		if _, ok := tasks[parent]; !ok {
+			parent = ""
+		}
+		children[parent] = append(children[parent], id)
+	}
+
+	rows := make(map[string]*renderRow)
+	var span func(id string) *renderRow
+	span = func(id string) *renderRow {
+		if row, ok := rows[id]; ok {
+			return row
+		}
+		row := &renderRow{task: tasks[id]}
+		rows[id] = row
+		if len(children[id]) != 0 || row.task.Type == "project" {
+			row.summary = true
+			for _, child := range children[id] {
+				c := span(child)
+				if !c.scheduled {
+					continue
+				}
+				if !row.scheduled || c.start < row.start {
+					row.start = c.start
+				}
+				if !row.scheduled || c.finish > row.finish {
+					row.finish = c.finish
+				}
+				row.scheduled = true
+			}
+			return row
+		}
+		if node, _ := newScheduleNode(&row.task, cal); node != nil {
+			row.scheduled = true
+			row.start, row.finish = node.start, node.ef
+		}
+		return row
+	}
+
+	for id := range tasks {
+		span(id)
+	}
+
+	for _, ids := range children {
+		sort.Slice(ids, func(i, j int) bool {
+			a, b := rows[ids[i]], rows[ids[j]]
+			if a.scheduled != b.scheduled {
+				return a.scheduled
+			}
+			if a.scheduled && a.start != b.start {
+				return a.start < b.start
+			}
+			return ids[i] < ids[j]
+		})
+	}
+
+	ordered := []*renderRow{}
+	var visit func(id string, level int)
+	visit = func(id string, level int) {
+		for _, child := range children[id] {
+			row := rows[child]
+			row.level = level
+			ordered = append(ordered, row)
+			visit(child, level+1)
+		}
+	}
+	visit("", 0)
+	return ordered
+}
+
+// Shorten the text to fit the given width in pixels
+func renderFit(text string, width int) string {
+	runes := []rune(text)
+	max := width / renderCharWidth
+	if len(runes) <= max {
+		return text
+	}
+	if max <= 3 {
+		return ""
+	}
+	return string(runes[:max-3]) + "..."
+}
+
+// Lay the chart out as a list of drawing primitives
+func renderPlan(plan *PlanningData, cal *Calendar, opts *RenderOpts) (*renderScene, error) {
+	zoom := opts.Zoom
+	if zoom == "" {
+		zoom = renderZoomDefault
+	}
+	dayWidth, ok := renderZooms[zoom]
+	if !ok {
+		return nil, fmt.Errorf("Unknown zoom level: %q", zoom)
+	}
+
+	rows := renderRows(plan, cal, opts.Closed)
+
+	// The time range defaults to the span of all the tasks
+	from, to, found := 0, 0, false
+	for _, row := range rows {
+		if !row.scheduled {
+			continue
+		}
+		if !found || row.start < from {
+			from = row.start
+		}
+		if !found || row.finish > to {
+			to = row.finish
+		}
+		found = true
+	}
+	if !found {
+		from, to = opts.Today, opts.Today+30
+	}
+	from, to = from-2, to+2
+
+	var err error
+	if opts.From != "" {
+		if from, err = parseDay(opts.From); err != nil {
+			return nil, fmt.Errorf("Malformed start of the range: %s", err)
+		}
+	}
+	if opts.To != "" {
+		if to, err = parseDay(opts.To); err != nil {
+			return nil, fmt.Errorf("Malformed end of the range: %s", err)
+		}
+		// The last day is included
+		to++
+	}
+	if to <= from {
+		return nil, fmt.Errorf("The range ends before it starts")
+	}
+
+	sc := &renderScene{
+		width:  renderGridWidth + (to-from)*dayWidth,
+		height: 2*renderScaleRow + len(rows)*renderRowHeight + renderMargin,
+	}
+	if sc.width > renderMaxWidth || sc.height > renderMaxHeight {
+		return nil, fmt.Errorf("The chart would be too large: %dx%d pixels", sc.width, sc.height)
+	}
+
+	dayX := func(day int) int {
+		return renderGridWidth + (day-from)*dayWidth
+	}
+	clampX := func(x int) int {
+		return int(math.Max(renderGridWidth, math.Min(float64(x), float64(sc.width))))
+	}
+	top := 2 * renderScaleRow
+
+	sc.rect(0, 0, sc.width, sc.height, renderBackground)
+
+	// Scale: months on the first row, days or weeks on the second one
+	for day := from; day < to; day++ {
+		tm := dayTime(day)
+		x := dayX(day)
+		if zoom == "day" && !cal.IsWorkday(day, "") {
+			sc.rect(x, top, dayWidth, sc.height-top, renderWeekend)
+		}
+		if tm.Day() == 1 || day == from {
+			sc.line(x, 0, x, renderScaleRow, renderGridLine)
+			label := tm.Format("January 2006")
+			if zoom == "month" {
+				label = tm.Format("Jan 06")
+			}
+			sc.text(x+4, renderScaleRow-6, label, renderTextColor, false)
+		}
+		switch {
+		case zoom == "day":
+			sc.line(x, renderScaleRow, x, sc.height, renderGridLine)
+			sc.text(x+4, top-6, fmt.Sprintf("%d", tm.Day()), renderTextColor, false)
+		case zoom == "week" && tm.Weekday() == 1:
+			_, week := tm.ISOWeek()
+			sc.line(x, renderScaleRow, x, sc.height, renderGridLine)
+			sc.text(x+4, top-6, fmt.Sprintf("W%d", week), renderTextColor, false)
+		case zoom == "month" && tm.Day() == 1:
+			sc.line(x, renderScaleRow, x, sc.height, renderGridLine)
+		}
+	}
+	sc.line(0, renderScaleRow, sc.width, renderScaleRow, renderGridLine)
+	sc.line(0, top, sc.width, top, renderGridLine)
+	sc.line(renderGridWidth, 0, renderGridWidth, sc.height, renderGridLine)
+	sc.text(6, top-6, "Task name", renderTextColor, true)
+
+	// Tasks
+	index := make(map[string]int)
+	for i, row := range rows {
+		index[row.task.Id] = i
+		y := top + i*renderRowHeight
+		sc.line(0, y+renderRowHeight, sc.width, y+renderRowHeight, renderGridLine)
+
+		indent := 6 + row.level*renderIndent
+		sc.text(indent, y+renderRowHeight-7, renderFit(row.task.Text, renderGridWidth-indent-4),
+			renderTextColor, row.summary)
+
+		if !row.scheduled || row.finish < from || row.start >= to {
+			continue
+		}
+
+		mid := y + renderRowHeight/2
+		if row.task.Type == "milestone" {
+			x := dayX(row.start)
+			if x < renderGridWidth {
+				continue
+			}
+			r := renderRowHeight/2 - 4
+			sc.polygon(renderMilestone, [2]int{x, mid - r}, [2]int{x + r, mid},
+				[2]int{x, mid + r}, [2]int{x - r, mid})
+			sc.text(x+r+4, y+renderRowHeight-7, renderFit(row.task.Text, 40*renderCharWidth),
+				renderTextColor, false)
+			continue
+		}
+
+		x1, x2 := clampX(dayX(row.start)), clampX(dayX(row.finish))
+		if x2 <= x1 {
+			continue
+		}
+		fill := renderTaskColor
+		if row.summary {
+			fill = renderSummary
+		}
+		sc.rect(x1, y+4, x2-x1, renderRowHeight-8, fill)
+		if !row.summary && row.task.Progress > 0 {
+			w := int(float32(dayX(row.finish)-dayX(row.start)) * row.task.Progress)
+			if px2 := clampX(dayX(row.start) + w); px2 > x1 {
+				sc.rect(x1, y+4, px2-x1, renderRowHeight-8, renderProgress)
+			}
+		}
+	}
+
+	// Dependency arrows, leaving the source bar at its start or finish and
+	// entering the target bar at its start or finish depending on the type
+	links := append([]Link{}, plan.Links...)
+	sort.Slice(links, func(i, j int) bool { return links[i].Id < links[j].Id })
+	for _, link := range links {
+		si, ok1 := index[link.Source]
+		ti, ok2 := index[link.Target]
+		if !ok1 || !ok2 || !rows[si].scheduled || !rows[ti].scheduled {
+			continue
+		}
+		source, target := rows[si], rows[ti]
+
+		sx, sdir := dayX(source.finish), 1
+		if link.Type == LinkStartToStart || link.Type == LinkStartToFinish {
+			sx, sdir = dayX(source.start), -1
+		}
+		tx, tdir := dayX(target.start), -1
+		if link.Type == LinkFinishToFinish || link.Type == LinkStartToFinish {
+			tx, tdir = dayX(target.finish), 1
+		}
+
+		sy := top + si*renderRowHeight + renderRowHeight/2
+		ty := top + ti*renderRowHeight + renderRowHeight/2
+		bx := sx + sdir*renderArrowStub
+		ex := tx + tdir*renderArrowStub
+		my := ty
+		if (tdir == -1 && ex < bx) || (tdir == 1 && ex > bx) {
+			// Go around between the rows
+			my = (sy + ty) / 2
+			if si == ti {
+				my = sy + renderRowHeight/2
+			}
+		}
+
+		points := [][2]int{{sx, sy}, {bx, sy}, {bx, my}, {ex, my}, {ex, ty}, {tx, ty}}
+		visible := true
+		for _, p := range points {
+			visible = visible && p[0] >= renderGridWidth && p[0] <= sc.width
+		}
+		if !visible {
+			continue
+		}
+		for i := 1; i < len(points); i++ {
+			a, b := points[i-1], points[i]
+			if a != b {
+				sc.line(a[0], a[1], b[0], b[1], renderLinkColor)
+			}
+		}
+		d := -tdir * renderArrowSize
+		sc.polygon(renderLinkColor, [2]int{tx, ty}, [2]int{tx - d, ty - renderArrowSize},
+			[2]int{tx - d, ty + renderArrowSize})
+	}
+
+	if x := dayX(opts.Today); opts.Today >= from && opts.Today < to {
+		sc.line(x, renderScaleRow, x, sc.height, renderToday)
+	}
+
+	return sc, nil
+}
+
+func (sc *renderScene) SVG() []byte {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" `+
+		`font-family="Arial, sans-serif" font-size="12">`+"\n", sc.width, sc.height, sc.width, sc.height)
+	for _, item := range sc.items {
+		item.writeSVG(buf)
+	}
+	buf.WriteString("</svg>\n")
+	return buf.Bytes()
+}
+
+func (r *renderRect) writeSVG(buf *bytes.Buffer) {
+	fmt.Fprintf(buf, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"/>`+"\n", r.x, r.y, r.w, r.h, r.fill)
+}
+
+func (l *renderLine) writeSVG(buf *bytes.Buffer) {
+	fmt.Fprintf(buf, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="%s"/>`+"\n",
+		l.x1, l.y1, l.x2, l.y2, l.stroke)
+}
+
+func (p *renderPolygon) writeSVG(buf *bytes.Buffer) {
+	points := make([]string, 0, len(p.points))
+	for _, pt := range p.points {
+		points = append(points, fmt.Sprintf("%d,%d", pt[0], pt[1]))
+	}
+	fmt.Fprintf(buf, `<polygon points="%s" fill="%s"/>`+"\n", strings.Join(points, " "), p.fill)
+}
+
+func (t *renderText) writeSVG(buf *bytes.Buffer) {
+	weight := ""
+	if t.bold {
+		weight = ` font-weight="bold"`
+	}
+	fmt.Fprintf(buf, `<text x="%d" y="%d" fill="%s"%s>%s</text>`+"\n",
+		t.x, t.y, t.fill, weight, html.EscapeString(t.text))
+}
+
+func parseRenderColor(hex string) color.RGBA {
+	var r, g, b uint8
+	fmt.Sscanf(hex, "#%02x%02x%02x", &r, &g, &b)
+	return color.RGBA{r, g, b, 255}
+}
+
+// Rasterize the scene. The lines are either horizontal or vertical and the
+// polygons are convex, which keeps the rasterizer trivial.
+func (sc *renderScene) PNG() ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, sc.width, sc.height))
+	for _, item := range sc.items {
+		item.draw(img)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, img); err != nil {
+		return nil, fmt.Errorf("Cannot encode the chart: %s", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (r *renderRect) draw(img *image.RGBA) {
+	draw.Draw(img, image.Rect(r.x, r.y, r.x+r.w, r.y+r.h),
+		image.NewUniform(parseRenderColor(r.fill)), image.Point{}, draw.Src)
+}
+
+func (l *renderLine) draw(img *image.RGBA) {
+	x1, x2 := l.x1, l.x2
+	if x1 > x2 {
+		x1, x2 = x2, x1
+	}
+	y1, y2 := l.y1, l.y2
+	if y1 > y2 {
+		y1, y2 = y2, y1
+	}
+	draw.Draw(img, image.Rect(x1, y1, x2+1, y2+1),
+		image.NewUniform(parseRenderColor(l.stroke)), image.Point{}, draw.Src)
+}
+
+func (p *renderPolygon) draw(img *image.RGBA) {
+	c := parseRenderColor(p.fill)
+	bounds := image.Rectangle{}
+	for i, pt := range p.points {
+		r := image.Rect(pt[0], pt[1], pt[0]+1, pt[1]+1)
+		if i == 0 {
+			bounds = r
+		} else {
+			bounds = bounds.Union(r)
+		}
+	}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if insideConvex(p.points, x, y) {
+				img.Set(x, y, c)
+			}
+		}
+	}
+}
+
+func (t *renderText) draw(img *image.RGBA) {
+	d := &font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(parseRenderColor(t.fill)),
+		Face: basicfont.Face7x13,
+		Dot:  fixed.P(t.x, t.y),
+	}
+	d.DrawString(t.text)
+	if t.bold {
+		d.Dot = fixed.P(t.x+1, t.y)
+		d.DrawString(t.text)
+	}
+}
+
+// Check if the point lies within the convex polygon, whatever its orientation
+func insideConvex(points [][2]int, x, y int) bool {
+	pos, neg := false, false
+	for i := range points {
+		a, b := points[i], points[(i+1)%len(points)]
+		cross := (b[0]-a[0])*(y-a[1]) - (b[1]-a[1])*(x-a[0])
+		pos = pos || cross > 0
+		neg = neg || cross < 0
+	}
+	return !(pos && neg)
+}
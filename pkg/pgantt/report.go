@@ -0,0 +1,309 @@
+//------------------------------------------------------------------------------
+// Copyright (C) 2021 Daedalean AG
+//
+// This file is part of PGantt.
+//
+// PGantt is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// PGantt is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with PGantt.  If not, see <https://www.gnu.org/licenses/>.
+//------------------------------------------------------------------------------
+
+package pgantt
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// Supported report formats, Remarkup is what Phriction understands
+const (
+	ReportMarkdown = "md"
+	ReportHTML     = "html"
+	ReportRemarkup = "remarkup"
+)
+
+// The baselines recorded by the reports, so that the next report can tell
+// what has changed since, are named after the time they were recorded
+const reportBaselineFormat = "20060102-150405"
+
+// The baselines of the reports are kept apart from the ones saved by the users
+func reportBaselineDir(dir string) string {
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "reports")
+}
+
+// The last working day of a scheduled task. The finish date is exclusive and
+// milestones take no time, so they are due on their start date.
+func dueDay(task *Task, cal *Calendar) (int, bool) {
+	node, _ := newScheduleNode(task, cal)
+	if node == nil {
+		return 0, false
+	}
+	if node.dur == 0 {
+		return node.start, true
+	}
+	return node.ef - 1, true
+}
+
+// Collect the tasks that need attention: the open ones that should have been
+// finished by now, the milestones coming in the next weeks, and the ones that
+// have not been scheduled yet. The changes are computed against the previous
+// report, if there is one.
+func buildStatusReport(plan *PlanningData, cal *Calendar, users []User, today, weeks int,
+	previous *Baseline) *StatusReport {
+
+	report := &StatusReport{
+		Date:        formatDay(today),
+		Weeks:       weeks,
+		Overdue:     make([]ReportTask, 0),
+		Milestones:  make([]ReportTask, 0),
+		Unscheduled: make([]ReportTask, 0),
+	}
+
+	userNames := make(map[string]string)
+	for _, user := range users {
+		userNames[user.Phid] = user.Name
+	}
+
+	for _, task := range plan.Data {
+		if task.External || !task.Open || task.Type == "project" {
+			continue
+		}
+
+		rt := ReportTask{
+			Id:        task.Id,
+			Text:      task.Text,
+			Url:       task.Url,
+			Owner:     userNames[task.Owner],
+			StartDate: task.StartDate,
+			Progress:  task.Progress,
+		}
+
+		last, ok := dueDay(&task, cal)
+		if !ok {
+			if task.StartDate == "" {
+				report.Unscheduled = append(report.Unscheduled, rt)
+			}
+			continue
+		}
+		rt.Due = formatDay(last)
+
+		if last < today && task.Progress < 1 {
+			report.Overdue = append(report.Overdue, rt)
+		}
+
+		if task.Type == "milestone" && last >= today && last < today+7*weeks {
+			report.Milestones = append(report.Milestones, rt)
+		}
+	}
+
+	byDue := func(tasks []ReportTask) {
+		sort.Slice(tasks, func(i, j int) bool {
+			if tasks[i].Due != tasks[j].Due {
+				return tasks[i].Due < tasks[j].Due
+			}
+			return tasks[i].Id < tasks[j].Id
+		})
+	}
+	byDue(report.Overdue)
+	byDue(report.Milestones)
+	byDue(report.Unscheduled)
+
+	if previous != nil {
+		report.Changes = compareBaseline(previous, plan, cal)
+	}
+
+	return report
+}
+
+const reportTextTemplate = `{{h1}}Status of {{.Name}}
+
+Generated on {{.Date}}.
+
+{{h2}}Overdue tasks
+
+{{if .Overdue}}| Task | Owner | Due | Progress |
+| --- | --- | --- | --- |
+{{range .Overdue}}| {{link .Text .Url}} | {{cell .Owner}} | {{.Due}} | {{percent .Progress}} |
+{{end}}{{else}}None.
+{{end}}
+{{h2}}Milestones in the next {{.Weeks}} weeks
+
+{{if .Milestones}}| Milestone | Owner | Date |
+| --- | --- | --- |
+{{range .Milestones}}| {{link .Text .Url}} | {{cell .Owner}} | {{.Due}} |
+{{end}}{{else}}None.
+{{end}}
+{{h2}}Tasks with no start date
+
+{{if .Unscheduled}}{{range .Unscheduled}}- {{link .Text .Url}}{{if .Owner}} ({{cell .Owner}}){{end}}
+{{end}}{{else}}None.
+{{end}}
+{{h2}}Changes since the last report
+{{with .Changes}}
+Compared to the report of {{.Created}}.
+
+{{if .Tasks}}| Task | Change | Start slip | Duration change |
+| --- | --- | --- | --- |
+{{range .Tasks}}| {{cell .Text}} | {{.Status}} | {{signed .StartSlip}} | {{signed .DurationChange}} |
+{{end}}{{else}}None.
+{{end}}{{else}}
+This is the first report.
+{{end}}`
+
+const reportHTMLTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Status of {{.Name}}</title>
+</head>
+<body>
+<h1>Status of {{.Name}}</h1>
+<p>Generated on {{.Date}}.</p>
+
+<h2>Overdue tasks</h2>
+{{if .Overdue}}<table>
+<tr><th>Task</th><th>Owner</th><th>Due</th><th>Progress</th></tr>
+{{range .Overdue}}<tr><td><a href="{{.Url}}">{{.Text}}</a></td><td>{{.Owner}}</td><td>{{.Due}}</td><td>{{percent .Progress}}</td></tr>
+{{end}}</table>
+{{else}}<p>None.</p>
+{{end}}
+<h2>Milestones in the next {{.Weeks}} weeks</h2>
+{{if .Milestones}}<table>
+<tr><th>Milestone</th><th>Owner</th><th>Date</th></tr>
+{{range .Milestones}}<tr><td><a href="{{.Url}}">{{.Text}}</a></td><td>{{.Owner}}</td><td>{{.Due}}</td></tr>
+{{end}}</table>
+{{else}}<p>None.</p>
+{{end}}
+<h2>Tasks with no start date</h2>
+{{if .Unscheduled}}<ul>
+{{range .Unscheduled}}<li><a href="{{.Url}}">{{.Text}}</a>{{if .Owner}} ({{.Owner}}){{end}}</li>
+{{end}}</ul>
+{{else}}<p>None.</p>
+{{end}}
+<h2>Changes since the last report</h2>
+{{with .Changes}}<p>Compared to the report of {{.Created}}.</p>
+{{if .Tasks}}<table>
+<tr><th>Task</th><th>Change</th><th>Start slip</th><th>Duration change</th></tr>
+{{range .Tasks}}<tr><td>{{.Text}}</td><td>{{.Status}}</td><td>{{signed .StartSlip}}</td><td>{{signed .DurationChange}}</td></tr>
+{{end}}</table>
+{{else}}<p>None.</p>
+{{end}}{{else}}<p>This is the first report.</p>
+{{end}}</body>
+</html>
+`
+
+func reportPercent(progress float32) string {
+	return fmt.Sprintf("%d%%", int(math.Round(float64(progress)*100)))
+}
+
+func reportSigned(n int) string {
+	if n == 0 {
+		return "0"
+	}
+	return fmt.Sprintf("%+d", n)
+}
+
+// The table cells cannot contain the pipe characters, neither in Markdown nor
+// in Remarkup
+func reportCell(text string) string {
+	return strings.ReplaceAll(text, "|", "/")
+}
+
+// Write out the report as Markdown, Remarkup or HTML
+func FormatStatusReport(report *StatusReport, format string) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	var err error
+
+	switch format {
+	case ReportMarkdown, ReportRemarkup:
+		funcs := template.FuncMap{
+			"h1":      func() string { return "# " },
+			"h2":      func() string { return "## " },
+			"cell":    reportCell,
+			"percent": reportPercent,
+			"signed":  reportSigned,
+			"link": func(text, url string) string {
+				text = strings.NewReplacer("[", `\[`, "]", `\]`).Replace(reportCell(text))
+				return fmt.Sprintf("[%s](%s)", text, url)
+			},
+		}
+		if format == ReportRemarkup {
+			funcs["h1"] = func() string { return "= " }
+			funcs["h2"] = func() string { return "== " }
+			funcs["link"] = func(text, url string) string {
+				return fmt.Sprintf("[[ %s | %s ]]", url, strings.ReplaceAll(reportCell(text), "]]", "] ]"))
+			}
+		}
+		tmpl := template.Must(template.New("report").Funcs(funcs).Parse(reportTextTemplate))
+		err = tmpl.Execute(buf, report)
+
+	case ReportHTML:
+		funcs := htmltemplate.FuncMap{
+			"percent": reportPercent,
+			"signed":  reportSigned,
+		}
+		tmpl := htmltemplate.Must(htmltemplate.New("report").Funcs(funcs).Parse(reportHTMLTemplate))
+		err = tmpl.Execute(buf, report)
+
+	default:
+		return nil, fmt.Errorf("Unsupported report format: %q", format)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Cannot render the report: %s", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// The most recent baseline recorded by a report. The names of these baselines
+// sort by the time they were recorded, so only the newest one gets loaded.
+func lastReportBaseline(dir, projPhid string) (*Baseline, error) {
+	dir = reportBaselineDir(dir)
+	if dir == "" {
+		return nil, nil
+	}
+
+	files, err := ioutil.ReadDir(filepath.Join(dir, projPhid))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list the baselines: %s", err)
+	}
+
+	last := ""
+	for _, file := range files {
+		name := strings.TrimSuffix(file.Name(), ".json")
+		if file.IsDir() || name == file.Name() {
+			continue
+		}
+		if name > last {
+			last = name
+		}
+	}
+
+	if last == "" {
+		return nil, nil
+	}
+	return loadBaseline(dir, projPhid, last)
+}
@@ -0,0 +1,101 @@
+//------------------------------------------------------------------------------
+// Copyright (C) 2021 Daedalean AG
+//
+// This file is part of PGantt.
+//
+// PGantt is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// PGantt is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with PGantt.  If not, see <https://www.gnu.org/licenses/>.
+//------------------------------------------------------------------------------
+
+package pgantt
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestLastReportBaseline(t *testing.T) {
+	dir := t.TempDir()
+
+	if baseline, err := lastReportBaseline(dir, "P"); baseline != nil || err != nil {
+		t.Fatalf("Expected no baseline, got %+v, %v", baseline, err)
+	}
+
+	for _, name := range []string{"20210301-090000", "20210308-090000"} {
+		baseline := &Baseline{Name: name, Project: "P", Created: "2021-03-01"}
+		if err := saveBaseline(reportBaselineDir(dir), baseline); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The baselines saved by the users are not even read
+	if err := saveBaseline(dir, &Baseline{Name: "release", Project: "P", Created: "2021-03-01"}); err != nil {
+		t.Fatal(err)
+	}
+	fileName := filepath.Join(dir, "P", "zzz.json")
+	if err := ioutil.WriteFile(fileName, []byte("malformed"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	baseline, err := lastReportBaseline(dir, "P")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if baseline == nil || baseline.Name != "20210308-090000" {
+		t.Errorf("Expected the baseline of the last report, got %+v", baseline)
+	}
+}
+
+// Only the delivered reports are compared against, and their baselines do not
+// show up among the ones saved by the users
+func TestRecordReportBaseline(t *testing.T) {
+	f := newFakeConduit(t)
+	sm := testStateManager(t, f, map[string]map[string]*PTask{"P": testTasks(testTask("A", "2021-03-01", 3))})
+	sm.opts.PGantt.BaselineDir = t.TempDir()
+
+	report, err := sm.StatusReport("P", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Changes != nil {
+		t.Errorf("Expected the first report, got the changes since %s", report.Changes.Created)
+	}
+
+	report, err = sm.StatusReport("P", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Changes != nil {
+		t.Errorf("A report that was not recorded is compared against")
+	}
+
+	if err := sm.RecordReportBaseline("P"); err != nil {
+		t.Fatal(err)
+	}
+	report, err = sm.StatusReport("P", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Changes == nil || len(report.Changes.Tasks) != 0 {
+		t.Errorf("Expected no changes since the recorded report, got %+v", report.Changes)
+	}
+
+	infos, err := sm.Baselines("P")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 0 {
+		t.Errorf("The report baseline is listed among the user ones: %+v", infos)
+	}
+}
@@ -0,0 +1,133 @@
+//------------------------------------------------------------------------------
+// Copyright (C) 2021 Daedalean AG
+//
+// This file is part of PGantt.
+//
+// PGantt is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// PGantt is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with PGantt.  If not, see <https://www.gnu.org/licenses/>.
+//------------------------------------------------------------------------------
+
+package pgantt
+
+import "sort"
+
+const defaultCapacity = 1.0
+
+// Compute the workload of everyone who has tasks assigned in the project. The
+// load is aggregated over all the projects, because people are usually booked
+// in more than one of them. Every open scheduled task counts as one unit of
+// work for every working day it spans, and nobody has any capacity on their
+// days off.
+func resourceLoad(projects map[string]map[string]*PTask, projPhid string, users []User,
+	capacities map[string]float64, cal *Calendar) *ResourceReport {
+
+	report := &ResourceReport{Resources: make([]ResourceLoad, 0)}
+
+	owners := make(map[string]bool)
+	for _, ptask := range projects[projPhid] {
+		if ptask.Task.Owner != "" {
+			owners[ptask.Task.Owner] = true
+		}
+	}
+
+	// Tasks may be tagged with more than one project, count them once
+	nodes := make(map[string]*scheduleNode)
+	for _, tasks := range projects {
+		for id, ptask := range tasks {
+			if _, ok := nodes[id]; ok || !ptask.Task.Open || !owners[ptask.Task.Owner] {
+				continue
+			}
+			if node, _ := newScheduleNode(&ptask.Task, cal); node != nil && node.dur > 0 {
+				nodes[id] = node
+			}
+		}
+	}
+
+	if len(nodes) == 0 {
+		return report
+	}
+
+	first, last := 0, 0
+	load := make(map[string]map[int]float64)
+	for _, node := range nodes {
+		if last == 0 || node.start < first {
+			first = node.start
+		}
+		if node.ef > last {
+			last = node.ef
+		}
+
+		owner := node.task.Owner
+		if load[owner] == nil {
+			load[owner] = make(map[int]float64)
+		}
+		for day := node.start; day < node.ef; day++ {
+			if cal.IsWorkday(day, owner) {
+				load[owner][day] += 1
+			}
+		}
+	}
+
+	report.Start = formatDay(first)
+	report.Finish = formatDay(last)
+
+	userNames := make(map[string]User)
+	for _, user := range users {
+		userNames[user.Phid] = user
+	}
+
+	phids := make([]string, 0, len(owners))
+	for phid := range owners {
+		phids = append(phids, phid)
+	}
+	sort.Strings(phids)
+
+	for _, phid := range phids {
+		res := ResourceLoad{User: phid, Name: userNames[phid].Name}
+		res.Capacity = defaultCapacity
+		if capacity, ok := capacities[res.Name]; ok {
+			res.Capacity = capacity
+		}
+		res.Days = make([]ResourceDay, 0, last-first)
+		res.Weeks = make([]ResourceWeek, 0)
+
+		for day := first; day < last; day++ {
+			capacity := 0.0
+			if cal.IsWorkday(day, phid) {
+				capacity = res.Capacity
+			}
+
+			rd := ResourceDay{Date: formatDay(day), Load: load[phid][day]}
+			rd.Over = rd.Load > capacity
+			res.Overbooked = res.Overbooked || rd.Over
+			res.Days = append(res.Days, rd)
+
+			// Weeks start on Monday, the epoch was a Thursday
+			week := day - (day+3)%7
+			if len(res.Weeks) == 0 || res.Weeks[len(res.Weeks)-1].Week != formatDay(week) {
+				res.Weeks = append(res.Weeks, ResourceWeek{Week: formatDay(week)})
+			}
+			rw := &res.Weeks[len(res.Weeks)-1]
+			rw.Load += rd.Load
+			rw.Capacity += capacity
+		}
+
+		for i := range res.Weeks {
+			res.Weeks[i].Over = res.Weeks[i].Load > res.Weeks[i].Capacity
+		}
+
+		report.Resources = append(report.Resources, res)
+	}
+
+	return report
+}
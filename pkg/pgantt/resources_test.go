@@ -0,0 +1,154 @@
+//------------------------------------------------------------------------------
+// Copyright (C) 2021 Daedalean AG
+//
+// This file is part of PGantt.
+//
+// PGantt is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// PGantt is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with PGantt.  If not, see <https://www.gnu.org/licenses/>.
+//------------------------------------------------------------------------------
+
+package pgantt
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResourceLoad(t *testing.T) {
+	cal := testCalendar(t)
+	users := []User{{Name: "alice", Phid: "PHID-USER-A"}, {Name: "bob", Phid: "PHID-USER-B"}}
+
+	owned := func(ptask *PTask, owner string) *PTask {
+		ptask.Task.Owner = owner
+		return ptask
+	}
+	closed := owned(testTask("A4", "2021-03-01", 5), "PHID-USER-A")
+	closed.Task.Open = false
+	shared := owned(testTask("B1", "2021-03-05", 2), "PHID-USER-B")
+
+	projects := map[string]map[string]*PTask{
+		"P": testTasks(
+			owned(testTask("A1", "2021-03-01", 3), "PHID-USER-A"),
+			owned(testTask("A2", "2021-03-03", 2), "PHID-USER-A"),
+			closed,
+			shared,
+		),
+		// Alice is booked here too, Carol has no tasks in P
+		"Q": testTasks(
+			owned(testTask("A3", "2021-03-04", 1), "PHID-USER-A"),
+			owned(testTask("C1", "2021-03-01", 5), "PHID-USER-C"),
+			shared,
+		),
+	}
+
+	report := resourceLoad(projects, "P", users, map[string]float64{"bob": 0.5}, cal)
+	if report.Start != "2021-03-01" || report.Finish != "2021-03-09" {
+		t.Errorf("Expected the report to span 2021-03-01 to 2021-03-09, got %s to %s",
+			report.Start, report.Finish)
+	}
+	if len(report.Resources) != 2 {
+		t.Fatalf("Expected the loads of alice and bob, got %+v", report.Resources)
+	}
+
+	tests := []struct {
+		name       string
+		capacity   float64
+		days       []float64
+		over       []bool
+		weeks      []ResourceWeek
+		overbooked bool
+	}{
+		{
+			// Monday to Monday, the tasks overlap on Wednesday and
+			// Thursday
+			name:     "alice",
+			capacity: 1,
+			days:     []float64{1, 1, 2, 2, 0, 0, 0, 0},
+			over:     []bool{false, false, true, true, false, false, false, false},
+			weeks: []ResourceWeek{
+				{Week: "2021-03-01", Load: 6, Capacity: 5, Over: true},
+				{Week: "2021-03-08", Load: 0, Capacity: 1},
+			},
+			overbooked: true,
+		},
+		{
+			// The shared task is counted once and skips the weekend
+			name:     "bob",
+			capacity: 0.5,
+			days:     []float64{0, 0, 0, 0, 1, 0, 0, 1},
+			over:     []bool{false, false, false, false, true, false, false, true},
+			weeks: []ResourceWeek{
+				{Week: "2021-03-01", Load: 1, Capacity: 2.5},
+				{Week: "2021-03-08", Load: 1, Capacity: 0.5, Over: true},
+			},
+			overbooked: true,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res := report.Resources[i]
+			if res.Name != test.name || res.Capacity != test.capacity || res.Overbooked != test.overbooked {
+				t.Errorf("Expected %s with capacity %g, overbooked %t, got %s with %g, %t",
+					test.name, test.capacity, test.overbooked, res.Name, res.Capacity, res.Overbooked)
+			}
+
+			days := []float64{}
+			over := []bool{}
+			for _, day := range res.Days {
+				days = append(days, day.Load)
+				over = append(over, day.Over)
+			}
+			if !reflect.DeepEqual(days, test.days) || !reflect.DeepEqual(over, test.over) {
+				t.Errorf("Expected the daily loads %v over %v, got %v over %v", test.days, test.over, days, over)
+			}
+			if !reflect.DeepEqual(res.Weeks, test.weeks) {
+				t.Errorf("Expected the weekly loads %+v, got %+v", test.weeks, res.Weeks)
+			}
+		})
+	}
+}
+
+// Nobody has capacity while on vacation
+func TestResourceLoadVacations(t *testing.T) {
+	users := []User{{Name: "alice", Phid: "PHID-USER-A"}}
+	cal, err := NewCalendar(&CalendarOpts{
+		Weekend:   []int{0, 6},
+		Vacations: map[string][]string{"alice": {"2021-03-02"}},
+	}, users)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	task := testTask("A1", "2021-03-01", 2)
+	task.Task.Owner = "PHID-USER-A"
+	projects := map[string]map[string]*PTask{"P": testTasks(task)}
+
+	report := resourceLoad(projects, "P", users, nil, cal)
+	if len(report.Resources) != 1 {
+		t.Fatalf("Expected the load of alice, got %+v", report.Resources)
+	}
+
+	// The task finishes on Wednesday, the vacation day is skipped
+	expected := []ResourceDay{
+		{Date: "2021-03-01", Load: 1},
+		{Date: "2021-03-02", Load: 0},
+		{Date: "2021-03-03", Load: 1},
+	}
+	if days := report.Resources[0].Days; !reflect.DeepEqual(days, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, days)
+	}
+	if weeks := report.Resources[0].Weeks; len(weeks) != 1 || weeks[0].Capacity != 2 {
+		t.Errorf("Expected a capacity of 2 days, got %+v", weeks)
+	}
+}
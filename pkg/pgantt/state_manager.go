@@ -29,16 +29,56 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// Returned when an edit is based on an outdated version of the task
+type ConflictError struct {
+	Task Task
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("Task %q has been modified by someone else", e.Task.Text)
+}
+
+// Returned when an edit went through, but the successors of the task could
+// not be moved along with it
+type CascadeError struct {
+	Task Task
+	Err  error
+}
+
+func (e *CascadeError) Error() string {
+	return fmt.Sprintf("Task %q was saved, but its successors were not rescheduled: %s", e.Task.Text, e.Err)
+}
+
 type StateManager struct {
+	opts     *Opts
 	phab     *Phabricator
 	m        sync.Mutex
+	names    []string
 	projects []Project
 	tasks    map[string]map[string]*PTask
 	users    []User
+	lastFull time.Time
+	events   EventHub
+	cal      *Calendar
+	notifier *notifier
+	starts   map[string]int
+	readOnly bool
 }
 
 func NewStateManager(opts *Opts) (*StateManager, error) {
+	return newStateManager(opts, false)
+}
+
+// State manager that reads the cache but never writes it, for the commands
+// that only inspect the state
+func NewReadOnlyStateManager(opts *Opts) (*StateManager, error) {
+	return newStateManager(opts, true)
+}
+
+func newStateManager(opts *Opts, readOnly bool) (*StateManager, error) {
 	sm := new(StateManager)
+	sm.opts = opts
+	sm.readOnly = readOnly
 	var err error
 
 	sm.phab, err = NewPhabricator(opts.PhabricatorUri, opts.ApiKey)
@@ -57,51 +97,202 @@ func NewStateManager(opts *Opts) (*StateManager, error) {
 		log.Printf("Using projects from ~/.arcrc: %s", strings.Join(projects, ", "))
 	}
 
-	sm.tasks = make(map[string]map[string]*PTask)
-	for _, projName := range projects {
-		log.Debugf("Attempting to fetch project info for: %s", projName)
-		proj, err := sm.phab.ProjectByName(projName)
-		if err != nil {
-			return nil, err
+	sm.names = projects
+	if cache := sm.loadCache(); cache != nil {
+		log.Infof("Loaded cached tasks from %s", opts.PGantt.CacheFile)
+		sm.projects = cache.Projects
+		sm.tasks = cache.Tasks
+		sm.starts = cache.Starts
+		sm.lastFull = time.Now()
+	} else {
+		sm.tasks = make(map[string]map[string]*PTask)
+		sm.starts = make(map[string]int)
+		for _, projName := range projects {
+			log.Debugf("Attempting to fetch project info for: %s", projName)
+			proj, err := sm.phab.ProjectByName(projName)
+			if err != nil {
+				return nil, err
+			}
+			sm.projects = append(sm.projects, *proj)
+			sm.tasks[proj.Phid] = make(map[string]*PTask)
 		}
-		sm.projects = append(sm.projects, *proj)
-		sm.tasks[proj.Phid] = make(map[string]*PTask)
 	}
 
 	if sm.users, err = sm.phab.Users(); err != nil {
 		return nil, err
 	}
 
+	if sm.cal, err = NewCalendar(&opts.PGantt.Calendar, sm.users); err != nil {
+		return nil, fmt.Errorf("Cannot set up the working calendar: %s", err)
+	}
+
 	log.Infof("Syncing tasks, it may take a while...")
 	if err := sm.SyncTasks(); err != nil {
 		return nil, err
 	}
 
-	log.Infof("Syncing tasks every %d seconds", time.Duration(opts.PGantt.PollInterval))
+	return sm, nil
+}
+
+// Keep polling Phabricator for changes in the background
+func (s *StateManager) StartPolling() {
+	interval := s.opts.PGantt.PollInterval
+	log.Infof("Syncing tasks every %d seconds", interval)
+
+	if s.opts.PGantt.Notifier.Enabled {
+		log.Infof("Commenting on the overdue and slipping tasks")
+		s.m.Lock()
+		s.notifier = newNotifier(s.phab, s.cal, &s.opts.PGantt.Notifier, s.starts)
+		s.m.Unlock()
+	}
+
 	go func() {
 		for {
-			time.Sleep(time.Duration(opts.PGantt.PollInterval) * time.Second)
-			if err := sm.SyncTasks(); err != nil {
+			time.Sleep(time.Duration(interval) * time.Second)
+			if err := s.SyncTasks(); err != nil {
 				log.Errorf("Failed to sync tasks: %s", err)
 			}
+			if s.notifier != nil {
+				s.notifier.flush()
+			}
 		}
 	}()
-
-	return sm, nil
 }
 
 func (s *StateManager) SyncTasks() error {
 	s.m.Lock()
 	defer s.m.Unlock()
 
+	// Only the tasks modified since the last poll are fetched normally, but
+	// every once in a while all of them are examined to catch anything the
+	// incremental updates may have missed
+	interval := time.Duration(s.opts.PGantt.FullSyncInterval) * time.Second
+	full := time.Since(s.lastFull) >= interval
+	if full {
+		log.Debugf("Running a full task synchronization")
+	}
+
+	events, err := s.syncTasks(full)
+	if err != nil {
+		return err
+	}
+	s.events.Publish(events)
+
+	// The comments are posted by the polling goroutine once the state is
+	// unlocked
+	if s.notifier != nil && s.notifier.check(s.allTasks(), int(time.Now().Unix()/86400)) {
+		s.saveCache()
+	}
+	return nil
+}
+
+// Run a full synchronization and report how it changed the state. Anything
+// reported means that the cache or the incremental updates missed something.
+// The changes are neither published nor written to the cache of a read-only
+// state manager.
+func (s *StateManager) SyncCheck() ([]PlanEvent, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.syncTasks(true)
+}
+
+func (s *StateManager) syncTasks(full bool) ([]PlanEvent, error) {
 	var err error
+	before := make(map[string]map[string]taskSnapshot)
 	for _, proj := range s.projects {
-		s.tasks[proj.Phid], err = s.phab.SyncTasksForProject(proj.Phid, s.tasks[proj.Phid])
+		before[proj.Phid] = snapshotTasks(s.tasks[proj.Phid])
+		s.tasks[proj.Phid], err = s.phab.SyncTasksForProject(proj.Phid, s.tasks[proj.Phid], full)
 		if err != nil {
-			return err
+			return nil, err
+		}
+	}
+
+	if full {
+		s.pruneLinks(before)
+	}
+
+	events := []PlanEvent{}
+	changed := false
+	for _, proj := range s.projects {
+		projEvents, projChanged := diffTasks(proj.Phid, before[proj.Phid], s.tasks[proj.Phid])
+		events = append(events, projEvents...)
+		changed = changed || projChanged
+	}
+
+	if full {
+		s.lastFull = time.Now()
+	}
+
+	if changed {
+		s.saveCache()
+	}
+	return events, nil
+}
+
+// Drop the links pointing at the tasks that have disappeared from the projects
+// during the last sync, unless they can still be found in another followed
+// project
+func (s *StateManager) pruneLinks(before map[string]map[string]taskSnapshot) {
+	all := s.allTasks()
+	removed := make(map[string]bool)
+	for projPhid, snap := range before {
+		for id := range snap {
+			if _, ok := s.tasks[projPhid][id]; ok {
+				continue
+			}
+			if _, ok := all[id]; !ok {
+				removed[id] = true
+			}
+		}
+	}
+
+	if len(removed) == 0 {
+		return
+	}
+
+	for _, tasks := range s.tasks {
+		for _, ptask := range tasks {
+			for linkId, link := range ptask.Links {
+				if removed[link.Target] {
+					delete(ptask.Links, linkId)
+				}
+			}
 		}
 	}
-	return nil
+}
+
+func (s *StateManager) loadCache() *StateCache {
+	if s.opts.PGantt.CacheFile == "" {
+		return nil
+	}
+	return LoadCache(s.opts.PGantt.CacheFile, s.opts.PhabricatorUri, s.names)
+}
+
+func (s *StateManager) saveCache() {
+	if s.opts.PGantt.CacheFile == "" || s.readOnly {
+		return
+	}
+
+	cache := StateCache{
+		Host:     s.opts.PhabricatorUri,
+		Names:    s.names,
+		Projects: s.projects,
+		Tasks:    s.tasks,
+		Starts:   s.starts,
+	}
+	if err := cache.Save(s.opts.PGantt.CacheFile); err != nil {
+		log.Errorf("Failed to save the task cache: %s", err)
+	}
+}
+
+// Subscribe to the changes of the project's plan
+func (s *StateManager) Subscribe(projPhid string) chan PlanEvent {
+	return s.events.Subscribe(projPhid)
+}
+
+func (s *StateManager) Unsubscribe(ch chan PlanEvent) {
+	s.events.Unsubscribe(ch)
 }
 
 func (s *StateManager) Projects() []Project {
@@ -110,24 +301,115 @@ func (s *StateManager) Projects() []Project {
 	return s.projects
 }
 
+func (s *StateManager) Users() []User {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.users
+}
+
+func (s *StateManager) WorkCalendar() *WorkCalendar {
+	return s.cal.WorkCalendar()
+}
+
 func (s *StateManager) PlanningData(phid string) *PlanningData {
 	s.m.Lock()
 	defer s.m.Unlock()
 
-	tasks, ok := s.tasks[phid]
-	if !ok {
+	if _, ok := s.tasks[phid]; !ok {
 		return nil
 	}
 
+	return s.planningData([]string{phid}, false)
+}
+
+// Merge the plans of several projects into one, grouping the tasks of each
+// project under a summary row. The tasks tagged with more than one of the
+// projects only show up under the first of them.
+func (s *StateManager) CombinedPlanningData(phids []string) (*PlanningData, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	seen := make(map[string]bool)
+	for _, phid := range phids {
+		if _, ok := s.tasks[phid]; !ok {
+			return nil, fmt.Errorf("Unknown project %s", phid)
+		}
+		if seen[phid] {
+			return nil, fmt.Errorf("Project %s requested more than once", phid)
+		}
+		seen[phid] = true
+	}
+
+	return s.planningData(phids, true), nil
+}
+
+func (s *StateManager) planningData(phids []string, summaries bool) *PlanningData {
 	plan := &PlanningData{}
 	plan.Data = make([]Task, 0)
 	plan.Links = make([]Link, 0)
 
-	for phid := range tasks {
-		task := tasks[phid]
-		plan.Data = append(plan.Data, task.Task)
-		for _, link := range task.Links {
-			plan.Links = append(plan.Links, *link)
+	tasks := make(map[string]bool)
+	for _, projPhid := range phids {
+		if summaries {
+			plan.Data = append(plan.Data, s.projectSummary(projPhid))
+		}
+
+		for id, ptask := range s.tasks[projPhid] {
+			if tasks[id] {
+				continue
+			}
+			tasks[id] = true
+
+			task := withFinishDate(ptask.Task, s.cal)
+			if summaries {
+				task.Project = projPhid
+				if task.Parent == "" {
+					task.Parent = projPhid
+				}
+			}
+			plan.Data = append(plan.Data, task)
+			for _, link := range ptask.Links {
+				plan.Links = append(plan.Links, *link)
+			}
+		}
+	}
+
+	// Links coming from the tasks of the other projects, the tasks tagged
+	// with several of them would otherwise bring their links more than once
+	incoming := make(map[string]bool)
+	for _, proj := range s.projects {
+		for id, ptask := range s.tasks[proj.Phid] {
+			if tasks[id] {
+				continue
+			}
+			for linkId, link := range ptask.Links {
+				if tasks[link.Target] && !incoming[linkId] {
+					incoming[linkId] = true
+					plan.Links = append(plan.Links, *link)
+				}
+			}
+		}
+	}
+
+	// The ends of the links that live in other projects are shown as
+	// read-only ghost tasks
+	ghosts := make(map[string]bool)
+	for _, link := range plan.Links {
+		for _, id := range []string{link.Source, link.Target} {
+			if tasks[id] || ghosts[id] {
+				continue
+			}
+			projPhid, ptask := s.findTask(id)
+			if ptask == nil {
+				continue
+			}
+			ghosts[id] = true
+			ghost := withFinishDate(ptask.Task, s.cal)
+			ghost.Parent = ""
+			ghost.Project = projPhid
+			ghost.External = true
+			ghost.Readonly = true
+			plan.Data = append(plan.Data, ghost)
 		}
 	}
 
@@ -142,23 +424,323 @@ func (s *StateManager) PlanningData(phid string) *PlanningData {
 	return plan
 }
 
-func (s *StateManager) EditTask(projPhid string, task *Task) (string, error) {
+// Synthetic row spanning all the tasks of the project
+func (s *StateManager) projectSummary(projPhid string) Task {
+	summary := Task{
+		Id:       projPhid,
+		Type:     "project",
+		Open:     true,
+		Project:  projPhid,
+		Readonly: true,
+	}
+	for _, proj := range s.projects {
+		if proj.Phid == projPhid {
+			summary.Text = proj.Name
+			break
+		}
+	}
+	return summary
+}
+
+// Find the task in any of the followed projects
+func (s *StateManager) findTask(id string) (string, *PTask) {
+	for _, proj := range s.projects {
+		if ptask, ok := s.tasks[proj.Phid][id]; ok {
+			return proj.Phid, ptask
+		}
+	}
+	return "", nil
+}
+
+// Tasks of all the followed projects, the ones tagged with multiple projects
+// are only included once
+func (s *StateManager) allTasks() map[string]*PTask {
+	all := make(map[string]*PTask)
+	for _, proj := range s.projects {
+		for id, ptask := range s.tasks[proj.Phid] {
+			if _, ok := all[id]; !ok {
+				all[id] = ptask
+			}
+		}
+	}
+	return all
+}
+
+func (s *StateManager) CriticalPath(phid string) (*CriticalPathData, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	tasks, ok := s.tasks[phid]
+	if !ok {
+		return nil, nil
+	}
+
+	// The tasks of the other projects may hold this project back, they
+	// show up on the path, but their dates are not reported
+	data, err := criticalPath(withPredecessors(s.allTasks(), tasks), s.cal)
+	if err != nil {
+		return nil, err
+	}
+
+	own := make([]CriticalPathTask, 0, len(data.Tasks))
+	for _, task := range data.Tasks {
+		if _, ok := tasks[task.Id]; ok {
+			own = append(own, task)
+		}
+	}
+	data.Tasks = own
+	return data, nil
+}
+
+func (s *StateManager) Resources(phid string) *ResourceReport {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if _, ok := s.tasks[phid]; !ok {
+		return nil
+	}
+
+	return resourceLoad(s.tasks, phid, s.users, s.opts.PGantt.Capacity, s.cal)
+}
+
+func (s *StateManager) Validate(phid string) *ValidationReport {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	tasks, ok := s.tasks[phid]
+	if !ok {
+		return nil
+	}
+
+	return validateTasks(tasks, s.allTasks(), s.cal)
+}
+
+// Save the current plan of the project under the given name
+func (s *StateManager) SaveBaseline(phid, name string) (*BaselineInfo, error) {
+	return s.saveBaseline(s.opts.PGantt.BaselineDir, phid, name)
+}
+
+func (s *StateManager) saveBaseline(dir, phid, name string) (*BaselineInfo, error) {
+	plan := s.PlanningData(phid)
+	if plan == nil {
+		return nil, nil
+	}
+
+	// The tasks of the other projects belong to their own baselines
+	data := make([]Task, 0, len(plan.Data))
+	for _, task := range plan.Data {
+		if !task.External {
+			data = append(data, task)
+		}
+	}
+	plan.Data = data
+
+	baseline := &Baseline{
+		Name:    name,
+		Project: phid,
+		Created: time.Now().UTC().Format(time.RFC3339),
+		Plan:    plan,
+	}
+	if err := saveBaseline(dir, baseline); err != nil {
+		return nil, err
+	}
+	return &BaselineInfo{baseline.Name, baseline.Created}, nil
+}
+
+func (s *StateManager) Baselines(phid string) ([]BaselineInfo, error) {
+	if !s.hasProject(phid) {
+		return nil, nil
+	}
+	return listBaselines(s.opts.PGantt.BaselineDir, phid)
+}
+
+// Compare the current plan of the project against one of its baselines
+func (s *StateManager) Variance(phid, name string) (*VarianceReport, error) {
+	plan := s.PlanningData(phid)
+	if plan == nil {
+		return nil, nil
+	}
+
+	baseline, err := loadBaseline(s.opts.PGantt.BaselineDir, phid, name)
+	if err != nil {
+		return nil, err
+	}
+	return compareBaseline(baseline, plan, s.cal), nil
+}
+
+// Serialize the plan of the project as CSV, JSON or Microsoft Project XML
+func (s *StateManager) Export(phid, format string) ([]byte, error) {
+	plan := s.PlanningData(phid)
+	if plan == nil {
+		return nil, nil
+	}
+	return exportPlan(format, s.projectName(phid), plan, s.cal)
+}
+
+// Create the tasks described by an MSPDI or CSV file in the project. The new
+// tasks land in the first column of the project's workboard. The state is not
+// locked while the tasks are being created, they show up with the next sync.
+func (s *StateManager) Import(phid, format string, data []byte, dryRun bool) (*ImportReport, error) {
+	s.m.Lock()
+	_, ok := s.tasks[phid]
+	column := ""
+	for _, proj := range s.projects {
+		if proj.Phid == phid && len(proj.Columns) != 0 {
+			column = proj.Columns[0].Phid
+		}
+	}
+	s.m.Unlock()
+
+	if !ok {
+		return nil, nil
+	}
+
+	tasks, err := parseImport(format, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return runImport(s.phab, phid, column, tasks, dryRun)
+}
+
+// iCalendar feed of the milestones of the project, or of all its scheduled
+// tasks
+func (s *StateManager) ICal(phid string, all bool) []byte {
+	plan := s.PlanningData(phid)
+	if plan == nil {
+		return nil
+	}
+	return exportICal(s.projectName(phid), plan, s.cal, all, time.Now())
+}
+
+// Draw the chart of the project, either as SVG or as PNG
+func (s *StateManager) Render(phid, format string, opts *RenderOpts) ([]byte, error) {
+	plan := s.PlanningData(phid)
+	if plan == nil {
+		return nil, nil
+	}
+
+	opts.Today = int(time.Now().Unix() / 86400)
+	scene, err := renderPlan(plan, s.cal, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case "svg":
+		return scene.SVG(), nil
+	case "png":
+		return scene.PNG()
+	}
+	return nil, fmt.Errorf("Unsupported image format: %q", format)
+}
+
+// Summarize the state of the project: the overdue tasks, the milestones
+// coming in the given number of weeks, the unscheduled tasks and what changed
+// since the last recorded report
+func (s *StateManager) StatusReport(phid string, weeks int) (*StatusReport, error) {
+	plan := s.PlanningData(phid)
+	if plan == nil {
+		return nil, nil
+	}
+
+	previous, err := lastReportBaseline(s.opts.PGantt.BaselineDir, phid)
+	if err != nil {
+		return nil, err
+	}
+
+	report := buildStatusReport(plan, s.cal, s.Users(), int(time.Now().Unix()/86400), weeks, previous)
+	report.Project = phid
+	report.Name = s.projectName(phid)
+	return report, nil
+}
+
+// Save the current plan as the baseline the next report compares against.
+// Call it once the report has been delivered.
+func (s *StateManager) RecordReportBaseline(phid string) error {
+	if s.opts.PGantt.BaselineDir == "" {
+		return fmt.Errorf("The baseline directory is not configured")
+	}
+	name := time.Now().UTC().Format(reportBaselineFormat)
+	_, err := s.saveBaseline(reportBaselineDir(s.opts.PGantt.BaselineDir), phid, name)
+	return err
+}
+
+// Post the report to the Phriction wiki, replacing the document if it exists
+func (s *StateManager) PublishReport(report *StatusReport, slug string) error {
+	content, err := FormatStatusReport(report, ReportRemarkup)
+	if err != nil {
+		return err
+	}
+
+	// Phriction takes the title from the document itself, so drop the
+	// heading
+	title := fmt.Sprintf("Status of %s", report.Name)
+	body := strings.TrimPrefix(string(content), "= "+title+"\n\n")
+	return s.phab.PublishDocument(slug, title, body)
+}
+
+// Find the PHID of a followed project given either its name or its PHID
+func (s *StateManager) ProjectPhid(name string) (string, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	for _, proj := range s.projects {
+		if proj.Name == name || proj.Phid == name {
+			return proj.Phid, nil
+		}
+	}
+	return "", fmt.Errorf("Unknown project %q", name)
+}
+
+func (s *StateManager) projectName(phid string) string {
+	s.m.Lock()
+	defer s.m.Unlock()
+	for _, proj := range s.projects {
+		if proj.Phid == phid {
+			return proj.Name
+		}
+	}
+	return ""
+}
+
+func (s *StateManager) hasProject(phid string) bool {
+	s.m.Lock()
+	defer s.m.Unlock()
+	_, ok := s.tasks[phid]
+	return ok
+}
+
+// Fill in the finish date of a scheduled task according to the working
+// calendar of its owner
+func withFinishDate(task Task, cal *Calendar) Task {
+	if node, _ := newScheduleNode(&task, cal); node != nil {
+		task.FinishDate = formatDay(node.ef)
+	}
+	return task
+}
+
+func (s *StateManager) EditTask(projPhid string, task *Task) (string, []TaskShift, error) {
 	s.m.Lock()
 	defer s.m.Unlock()
 
 	tasks, ok := s.tasks[projPhid]
 	if !ok {
-		return "", fmt.Errorf("No such project: %q", projPhid)
+		return "", nil, fmt.Errorf("No such project: %q", projPhid)
 	}
 
 	ptask, ok := tasks[task.Id]
+	if !ok {
+		if owner, _ := s.findTask(task.Id); owner != "" {
+			return "", nil, fmt.Errorf("Task %q belongs to another project", task.Text)
+		}
+	}
 
 	var tm time.Time
 	var err error
 	if task.StartDate != "" {
 		tm, err = time.Parse("2006-01-02", task.StartDate)
 		if err != nil {
-			return "", fmt.Errorf("Malformed start date: %s", err)
+			return "", nil, fmt.Errorf("Malformed start date: %s", err)
 		}
 	}
 
@@ -171,6 +753,9 @@ func (s *StateManager) EditTask(projPhid string, task *Task) (string, error) {
 		}
 		req.SetColumn(task.Column)
 		req.SetTitle(task.Text)
+		if task.Owner != "" {
+			req.SetOwner(task.Owner)
+		}
 
 		req.SetScheduled(!task.Unscheduled)
 		if task.StartDate != "" && tm.Unix() != 0 {
@@ -180,11 +765,41 @@ func (s *StateManager) EditTask(projPhid string, task *Task) (string, error) {
 		req.SetProgress(task.Progress)
 		req.SetType(task.Type)
 
-		return s.phab.EditTask(&req)
+		id, err := s.phab.EditTask(&req)
+		if err != nil {
+			return "", nil, err
+		}
+
+		// Cache the task right away so that the other clients see it before
+		// the next poll fills in the rest of its details
+		created := *task
+		created.Id = id
+		created.Open = true
+		created.Version = 0
+		if created.Parent == "0" {
+			created.Parent = ""
+		}
+		if task.StartDate == "" || tm.Unix() == 0 {
+			created.StartDate = ""
+			created.Duration = 0
+			created.Unscheduled = true
+		}
+		if parent, ok := tasks[created.Parent]; ok {
+			parent.IsLeaf = false
+		}
+		tasks[id] = &PTask{IsLeaf: true, Links: make(map[string]*Link), Task: created}
+		s.events.Publish([]PlanEvent{{Type: EventTaskAdded, Project: projPhid, Task: &created}})
+		return id, nil, nil
+	}
+
+	// Edit task. The version is optional, but if it's there, it needs to match
+	// the version of the cached task.
+	if task.Version != 0 && task.Version != ptask.Task.Version {
+		return "", nil, &ConflictError{ptask.Task}
 	}
 
-	// Edit task
 	numEds := 0
+	reschedule := false
 	req := EditRequest{}
 	req.SetObjectId(task.Id)
 	if ptask.Task.Column != task.Column {
@@ -197,6 +812,11 @@ func (s *StateManager) EditTask(projPhid string, task *Task) (string, error) {
 		numEds++
 	}
 
+	if ptask.Task.Owner != task.Owner {
+		req.SetOwner(task.Owner)
+		numEds++
+	}
+
 	if task.Parent != "" && ptask.Task.Parent != task.Parent {
 		if task.Parent == "0" {
 			req.RemoveParent()
@@ -218,11 +838,13 @@ func (s *StateManager) EditTask(projPhid string, task *Task) (string, error) {
 		} else {
 			req.SetStartDate(tm.Unix())
 		}
+		reschedule = true
 		numEds++
 	}
 
 	if ptask.Task.Duration != task.Duration {
 		req.SetDuration(task.Duration)
+		reschedule = true
 		numEds++
 	}
 
@@ -236,14 +858,72 @@ func (s *StateManager) EditTask(projPhid string, task *Task) (string, error) {
 		numEds++
 	}
 
-	if numEds > 0 {
-		return s.phab.EditTask(&req)
+	if numEds == 0 {
+		return task.Id, nil, nil
+	}
+
+	if _, err := s.phab.EditTask(&req); err != nil {
+		return "", nil, err
+	}
+
+	s.updateTask(task.Id, func(updated *Task) {
+		updated.Column = task.Column
+		updated.Text = task.Text
+		updated.Owner = task.Owner
+		if task.Parent == "0" {
+			updated.Parent = ""
+		} else if task.Parent != "" {
+			updated.Parent = task.Parent
+		}
+		updated.Unscheduled = task.Unscheduled
+		updated.StartDate = task.StartDate
+		updated.Duration = task.Duration
+		if task.StartDate == "" || tm.Unix() == 0 {
+			updated.StartDate = ""
+			updated.Unscheduled = true
+		}
+		updated.Progress = task.Progress
+		updated.Type = task.Type
+	})
+
+	if !s.opts.PGantt.AutoSchedule || !reschedule {
+		return task.Id, nil, nil
 	}
 
-	return task.Id, nil
+	shifts, err := s.rescheduleSuccessors(s.allTasks(), task)
+	return task.Id, shifts, err
 }
 
-func (s *StateManager) DeleteLink(projPhid, id string) error {
+// Move the successors of the edited task so that they satisfy their
+// dependencies again. The task itself has been saved already, so the failures
+// are reported as a CascadeError.
+func (s *StateManager) rescheduleSuccessors(tasks map[string]*PTask, task *Task) ([]TaskShift, error) {
+	shifts, err := propagateSchedule(tasks, task, s.cal)
+	if err != nil {
+		log.Warningf("Not rescheduling the successors of %q: %s", task.Id, err)
+		return nil, &CascadeError{*task, err}
+	}
+
+	for i, shift := range shifts {
+		tm, _ := time.Parse("2006-01-02", shift.StartDate)
+		req := EditRequest{}
+		req.SetObjectId(shift.Id)
+		req.SetStartDate(tm.Unix())
+		if _, err := s.phab.EditTask(&req); err != nil {
+			return shifts[:i], &CascadeError{*task, fmt.Errorf("Cannot reschedule task %q: %s", shift.Text, err)}
+		}
+		log.Infof("Rescheduled %q from %s to %s", shift.Text, shift.OldStartDate, shift.StartDate)
+		s.updateTask(shift.Id, func(task *Task) {
+			task.StartDate = shift.StartDate
+		})
+	}
+	return shifts, nil
+}
+
+// Delete the task in the way configured by the user and remove all the links
+// pointing to it. The links are only dropped once the task is gone, so that a
+// failed deletion leaves the plan intact.
+func (s *StateManager) DeleteTask(projPhid, id string) error {
 	s.m.Lock()
 	defer s.m.Unlock()
 
@@ -252,29 +932,118 @@ func (s *StateManager) DeleteLink(projPhid, id string) error {
 		return fmt.Errorf("No such project: %q", projPhid)
 	}
 
-	fragments := strings.Split(id, "#")
-	if len(fragments) != 3 {
-		return fmt.Errorf("Unable to decode link ID: %s", id)
+	ptask, ok := tasks[id]
+	if !ok {
+		return fmt.Errorf("No such task: %q", id)
+	}
+
+	// The subtasks of a task removed from the project would stay attached to
+	// it in Phabricator
+	if s.opts.PGantt.DeleteAction == DeleteRemove {
+		for _, task := range tasks {
+			if task.Task.Parent == id {
+				return fmt.Errorf("Task %q has subtasks, move or delete them first", ptask.Task.Text)
+			}
+		}
+	}
+
+	req := EditRequest{}
+	req.SetObjectId(id)
+	if s.opts.PGantt.DeleteAction == DeleteRemove {
+		req.RemoveProject(projPhid)
+	} else {
+		req.SetStatus("invalid")
+	}
+
+	if _, err := s.phab.EditTask(&req); err != nil {
+		return err
+	}
+
+	// The task will not show up in the incremental updates anymore once it's
+	// gone from the project
+	if s.opts.PGantt.DeleteAction == DeleteRemove {
+		delete(tasks, id)
+		task := ptask.Task
+		s.events.Publish([]PlanEvent{{Type: EventTaskRemoved, Project: projPhid, Task: &task}})
+	} else {
+		s.updateTask(id, func(task *Task) {
+			task.Open = false
+		})
+	}
+
+	// The same task may be cached in more than one project
+	edited := make(map[string]bool)
+	for _, proj := range s.projects {
+		for _, pred := range s.tasks[proj.Phid] {
+			links := []*Link{}
+			for _, link := range pred.Links {
+				if link.Target == id {
+					links = append(links, link)
+				}
+			}
+
+			if len(links) == 0 {
+				continue
+			}
+
+			remaining := copyLinks(pred.Links)
+			for _, link := range links {
+				delete(remaining, link.Id)
+			}
+
+			if edited[pred.Task.Id] {
+				pred.Links = remaining
+			} else {
+				if err := s.writeLinks(pred, remaining); err != nil {
+					return fmt.Errorf("Task %q deleted, but its links from %q remain: %s",
+						ptask.Task.Text, pred.Task.Text, err)
+				}
+				edited[pred.Task.Id] = true
+			}
+
+			events := []PlanEvent{}
+			for _, link := range links {
+				events = append(events, PlanEvent{Type: EventLinkRemoved, Project: proj.Phid, Link: link})
+			}
+			s.events.Publish(events)
+		}
 	}
+	return nil
+}
 
-	ptask, ok := tasks[fragments[0]]
+func (s *StateManager) DeleteLink(projPhid, id string) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	tasks, ok := s.tasks[projPhid]
 	if !ok {
-		return fmt.Errorf("No such source task: %q", fragments[0])
+		return fmt.Errorf("No such project: %q", projPhid)
 	}
 
-	if _, ok := ptask.Links[id]; !ok {
-		return fmt.Errorf("No such link: %q", id)
+	source, _, err := parseLinkId(id)
+	if err != nil {
+		return err
 	}
 
-	delete(ptask.Links, id)
+	ptask, ok := tasks[source]
+	if !ok {
+		if _, ptask = s.findTask(source); ptask == nil {
+			return fmt.Errorf("No such source task: %q", source)
+		}
+	}
 
-	linkData := getLinkSlice(ptask.Links)
-	req := EditRequest{}
-	req.SetObjectId(fragments[0])
-	req.SetSuccessors(linkData)
-	if _, err := s.phab.EditTask(&req); err != nil {
+	link, err := findLink(ptask, id)
+	if err != nil {
 		return err
 	}
+
+	links := copyLinks(ptask.Links)
+	delete(links, link.Id)
+	if err := s.writeLinks(ptask, links); err != nil {
+		return err
+	}
+
+	s.publishLinkEvent(EventLinkRemoved, link)
 	return nil
 }
 
@@ -291,13 +1060,103 @@ func getLinkSlice(links map[string]*Link) []PLinkData {
 		lSlice = append(lSlice, PLinkData{
 			Target: links[id].Target,
 			Type:   links[id].Type,
+			Lag:    links[id].Lag,
 		})
 	}
 	return lSlice
 }
 
+func copyLinks(links map[string]*Link) map[string]*Link {
+	cp := make(map[string]*Link, len(links))
+	for id, link := range links {
+		cp[id] = link
+	}
+	return cp
+}
+
+// Write the new successors of the task to Phabricator, the cache is only
+// updated if that succeeds
+func (s *StateManager) writeLinks(ptask *PTask, links map[string]*Link) error {
+	req := EditRequest{}
+	req.SetObjectId(ptask.Task.Id)
+	req.SetSuccessors(getLinkSlice(links))
+	if _, err := s.phab.EditTask(&req); err != nil {
+		return err
+	}
+	ptask.Links = links
+	return nil
+}
+
+// There can be at most one link between two tasks, so the ID does not depend
+// on the type of the link and stays the same when the link is edited
 func generateLinkId(link *Link) string {
-	return fmt.Sprintf("%s#%s#%s", link.Source, link.Target, link.Type)
+	return fmt.Sprintf("%s#%s", link.Source, link.Target)
+}
+
+// Two tasks are linked at most once. Adding the same link again yields the
+// link already there, a link of another type or lag is refused.
+func addLink(links map[string]*Link, link *Link) (*Link, error) {
+	link.Id = generateLinkId(link)
+	if old, ok := links[link.Id]; ok {
+		if old.Type == link.Type && old.Lag == link.Lag {
+			return old, nil
+		}
+		return nil, fmt.Errorf("Task %q is already linked to %q", link.Source, link.Target)
+	}
+	links[link.Id] = link
+	return link, nil
+}
+
+// Turn the successors stored in a task into links. Before the links could be
+// edited, two tasks could be linked more than once with different types; only
+// the first of such links is kept.
+func successorLinks(source string, linkData []PLinkData) map[string]*Link {
+	links := make(map[string]*Link)
+	for _, ld := range linkData {
+		link := &Link{Source: source, Target: ld.Target, Type: ld.Type, Lag: ld.Lag}
+		if _, err := addLink(links, link); err != nil {
+			log.Warningf("Ignoring the link of type %s and lag %d: %s", ld.Type, ld.Lag, err)
+		}
+	}
+	return links
+}
+
+// Find the link of the task by its ID. The old source#target#type IDs are
+// still accepted.
+func findLink(ptask *PTask, id string) (*Link, error) {
+	if link, ok := ptask.Links[id]; ok {
+		return link, nil
+	}
+
+	fragments := strings.Split(id, "#")
+	if len(fragments) != 2 && len(fragments) != 3 {
+		return nil, fmt.Errorf("Unable to decode link ID: %s", id)
+	}
+
+	var found *Link
+	for _, link := range ptask.Links {
+		if link.Target != fragments[1] || (len(fragments) == 3 && link.Type != fragments[2]) {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("Link %q is ambiguous", id)
+		}
+		found = link
+	}
+
+	if found == nil {
+		return nil, fmt.Errorf("No such link: %q", id)
+	}
+	return found, nil
+}
+
+// Decode the link ID, the old source#target#type format is still accepted
+func parseLinkId(id string) (source, target string, err error) {
+	fragments := strings.Split(id, "#")
+	if len(fragments) != 2 && len(fragments) != 3 {
+		return "", "", fmt.Errorf("Unable to decode link ID: %s", id)
+	}
+	return fragments[0], fragments[1], nil
 }
 
 func (s *StateManager) CreateLink(projPhid string, link *Link) (string, error) {
@@ -309,32 +1168,124 @@ func (s *StateManager) CreateLink(projPhid string, link *Link) (string, error) {
 		return "", fmt.Errorf("No such project: %q", projPhid)
 	}
 
-	ptask, ok := tasks[link.Source]
-	if !ok {
+	// One of the ends may live in another followed project
+	_, ptask := s.findTask(link.Source)
+	if ptask == nil {
 		return "", fmt.Errorf("No such source task: %q", link.Source)
 	}
 
-	_, ok = tasks[link.Source]
-	if !ok {
+	if _, target := s.findTask(link.Target); target == nil {
 		return "", fmt.Errorf("No such target task: %q", link.Target)
 	}
 
-	id := generateLinkId(link)
-	link.Id = id
+	_, sourceHere := tasks[link.Source]
+	_, targetHere := tasks[link.Target]
+	if !sourceHere && !targetHere {
+		return "", fmt.Errorf("Neither end of the link belongs to the project")
+	}
 
-	// This actually happrens because of a bug in the front end. It's fine to assume
-	// success because the ID encapsulates the complete link data
-	if _, ok = ptask.Links[id]; ok {
-		return id, nil
+	if sourceHere {
+		ptask = tasks[link.Source]
 	}
 
-	ptask.Links[id] = link
-	linkData := getLinkSlice(ptask.Links)
-	req := EditRequest{}
-	req.SetObjectId(link.Source)
-	req.SetSuccessors(linkData)
-	if _, err := s.phab.EditTask(&req); err != nil {
+	// The same link being created twice actually happens because of a bug in
+	// the front end, it's fine to assume success then
+	links := copyLinks(ptask.Links)
+	added, err := addLink(links, link)
+	if err != nil {
+		return "", fmt.Errorf("The tasks are already linked, edit the existing link instead")
+	}
+	if added != link {
+		return added.Id, nil
+	}
+	id := link.Id
+
+	if err := checkLinkCycle(s.allTasks(), link); err != nil {
 		return "", err
 	}
+
+	if err := s.writeLinks(ptask, links); err != nil {
+		return "", err
+	}
+
+	s.publishLinkEvent(EventLinkAdded, link)
 	return id, nil
 }
+
+// Change the type or the lag of an existing link
+func (s *StateManager) UpdateLink(projPhid string, link *Link) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	tasks, ok := s.tasks[projPhid]
+	if !ok {
+		return fmt.Errorf("No such project: %q", projPhid)
+	}
+
+	source, target, err := parseLinkId(link.Id)
+	if err != nil {
+		return err
+	}
+
+	if source != link.Source || target != link.Target {
+		return fmt.Errorf("The ends of link %q cannot be changed", link.Id)
+	}
+
+	ptask, ok := tasks[source]
+	if !ok {
+		if _, ptask = s.findTask(source); ptask == nil {
+			return fmt.Errorf("No such source task: %q", source)
+		}
+	}
+
+	old, err := findLink(ptask, link.Id)
+	if err != nil {
+		return err
+	}
+
+	link.Id = old.Id
+	if *old == *link {
+		return nil
+	}
+
+	links := copyLinks(ptask.Links)
+	links[link.Id] = link
+	if err := s.writeLinks(ptask, links); err != nil {
+		return err
+	}
+
+	s.publishLinkEvent(EventLinkUpdated, link)
+	return nil
+}
+
+// Apply an edit that went through to all the cached copies of the task and
+// notify the subscribers of the projects it belongs to. The next poll brings
+// the new modification time.
+func (s *StateManager) updateTask(id string, update func(task *Task)) {
+	events := []PlanEvent{}
+	for _, proj := range s.projects {
+		if ptask, ok := s.tasks[proj.Phid][id]; ok {
+			update(&ptask.Task)
+			// The edits made from the version the client had are stale now.
+			// The next sync replaces the version with the modification time.
+			ptask.Task.Version++
+			task := ptask.Task
+			events = append(events, PlanEvent{Type: EventTaskUpdated, Project: proj.Phid, Task: &task})
+		}
+	}
+	s.events.Publish(events)
+}
+
+// Notify the subscribers of all the projects the ends of the link belong to
+func (s *StateManager) publishLinkEvent(typ string, link *Link) {
+	events := []PlanEvent{}
+	for _, proj := range s.projects {
+		tasks := s.tasks[proj.Phid]
+		_, sourceHere := tasks[link.Source]
+		_, targetHere := tasks[link.Target]
+		if sourceHere || targetHere {
+			events = append(events, PlanEvent{Type: typ, Project: proj.Phid, Link: link})
+		}
+	}
+	s.events.Publish(events)
+}
@@ -0,0 +1,457 @@
+//------------------------------------------------------------------------------
+// Copyright (C) 2021 Daedalean AG
+//
+// This file is part of PGantt.
+//
+// PGantt is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// PGantt is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with PGantt.  If not, see <https://www.gnu.org/licenses/>.
+//------------------------------------------------------------------------------
+
+package pgantt
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Records the maniphest.edit calls made against the fake server
+type editLog struct {
+	m        sync.Mutex
+	requests []EditRequest
+	fail     func(req *EditRequest) error
+}
+
+func (l *editLog) edits() []EditRequest {
+	l.m.Lock()
+	defer l.m.Unlock()
+	return append([]EditRequest{}, l.requests...)
+}
+
+func (f *fakeConduit) handleEdits() *editLog {
+	l := &editLog{}
+	f.handle("maniphest.edit", func(params json.RawMessage) (interface{}, error) {
+		var req EditRequest
+		if err := json.Unmarshal(params, &req); err != nil {
+			return nil, err
+		}
+
+		l.m.Lock()
+		defer l.m.Unlock()
+		if l.fail != nil {
+			if err := l.fail(&req); err != nil {
+				return nil, err
+			}
+		}
+		l.requests = append(l.requests, req)
+
+		phid := req.ObjectIdentifier
+		if phid == "" {
+			phid = "PHID-TASK-NEW"
+		}
+		return map[string]interface{}{"object": map[string]string{"phid": phid}}, nil
+	})
+	return l
+}
+
+// State manager working on the given projects, without the initial sync
+func testStateManager(t testing.TB, f *fakeConduit, projects map[string]map[string]*PTask) *StateManager {
+	sm := &StateManager{
+		opts:     NewOpts(),
+		phab:     f.phabricator(t),
+		cal:      testCalendar(t),
+		tasks:    projects,
+		lastFull: time.Now(),
+	}
+	sm.opts.PGantt.CacheFile = ""
+	for phid := range projects {
+		sm.projects = append(sm.projects, Project{Name: phid, Phid: phid})
+	}
+	return sm
+}
+
+// Collect the events published so far
+func drainEvents(ch chan PlanEvent) []PlanEvent {
+	events := []PlanEvent{}
+	for {
+		select {
+		case ev := <-ch:
+			events = append(events, ev)
+		default:
+			return events
+		}
+	}
+}
+
+func TestEditTaskPublishesEvents(t *testing.T) {
+	f := newFakeConduit(t)
+	f.handleEdits()
+
+	tasks := testTasks(
+		testTask("A", "2021-03-01", 3),
+		testTask("B", "2021-03-04", 2),
+	)
+	testLink(tasks, "A", "B", LinkFinishToStart, 0)
+	sm := testStateManager(t, f, map[string]map[string]*PTask{"P": tasks})
+	sm.opts.PGantt.AutoSchedule = true
+	events := sm.Subscribe("P")
+
+	edited := tasks["A"].Task
+	edited.Duration = 5
+	if _, _, err := sm.EditTask("P", &edited); err != nil {
+		t.Fatal(err)
+	}
+
+	evs := drainEvents(events)
+	if len(evs) != 2 {
+		t.Fatalf("Expected 2 events, got %d: %+v", len(evs), evs)
+	}
+	if evs[0].Type != EventTaskUpdated || evs[0].Task.Id != "A" || evs[0].Task.Duration != 5 {
+		t.Errorf("Unexpected event for the edited task: %+v", evs[0].Task)
+	}
+	if evs[1].Type != EventTaskUpdated || evs[1].Task.Id != "B" || evs[1].Task.StartDate != "2021-03-08" {
+		t.Errorf("Unexpected event for the successor: %+v", evs[1].Task)
+	}
+	if tasks["B"].Task.StartDate != "2021-03-08" {
+		t.Errorf("The cached successor was not moved: %s", tasks["B"].Task.StartDate)
+	}
+
+	created := Task{Text: "New", Type: "task", Parent: "0", StartDate: "2021-03-01", Duration: 1}
+	id, _, err := sm.EditTask("P", &created)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	evs = drainEvents(events)
+	if len(evs) != 1 || evs[0].Type != EventTaskAdded || evs[0].Task.Id != id {
+		t.Errorf("Expected an added event for %s, got %+v", id, evs)
+	}
+	if _, ok := tasks[id]; !ok {
+		t.Errorf("The new task was not cached")
+	}
+}
+
+func TestDeleteTaskKeepsLinksOnFailure(t *testing.T) {
+	f := newFakeConduit(t)
+	edits := f.handleEdits()
+
+	tasks := testTasks(
+		testTask("A", "2021-03-01", 3),
+		testTask("B", "2021-03-04", 2),
+	)
+	testLink(tasks, "A", "B", LinkFinishToStart, 0)
+	sm := testStateManager(t, f, map[string]map[string]*PTask{"P": tasks})
+
+	edits.fail = func(req *EditRequest) error {
+		return fmt.Errorf("Permission denied")
+	}
+	if err := sm.DeleteTask("P", "B"); err == nil {
+		t.Fatal("The deletion did not fail")
+	}
+	if len(tasks["A"].Links) != 1 {
+		t.Errorf("The link to the task that failed to be deleted is gone")
+	}
+
+	edits.fail = nil
+	if err := sm.DeleteTask("P", "B"); err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks["A"].Links) != 0 {
+		t.Errorf("The link to the deleted task remains")
+	}
+	if tasks["B"].Task.Open {
+		t.Errorf("The deleted task is still open")
+	}
+
+	reqs := edits.edits()
+	if len(reqs) != 2 || reqs[0].ObjectIdentifier != "B" || reqs[1].ObjectIdentifier != "A" {
+		t.Errorf("Expected the task to be closed before its links were removed: %+v", reqs)
+	}
+}
+
+// Removing a task from the project would leave its subtasks attached to it
+func TestDeleteTaskWithSubtasks(t *testing.T) {
+	f := newFakeConduit(t)
+	edits := f.handleEdits()
+
+	tasks := testTasks(
+		testTask("A", "2021-03-01", 3),
+		testTask("B", "2021-03-04", 2),
+	)
+	tasks["B"].Task.Parent = "A"
+	sm := testStateManager(t, f, map[string]map[string]*PTask{"P": tasks})
+	sm.opts.PGantt.DeleteAction = DeleteRemove
+
+	if err := sm.DeleteTask("P", "A"); err == nil {
+		t.Fatal("A task with subtasks was removed")
+	}
+	if len(edits.edits()) != 0 || tasks["A"] == nil || tasks["B"].Task.Parent != "A" {
+		t.Errorf("The failed removal changed the plan: %+v", edits.edits())
+	}
+
+	if err := sm.DeleteTask("P", "B"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.DeleteTask("P", "A"); err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 0 {
+		t.Errorf("Expected both tasks to be gone, got %d", len(tasks))
+	}
+}
+
+// Two tasks are linked at most once, whether the links come from Phabricator,
+// the chart or an import
+func TestLinksBetweenTheSameTasks(t *testing.T) {
+	f := newFakeConduit(t)
+	edits := f.handleEdits()
+
+	tasks := testTasks(
+		testTask("A", "2021-03-01", 3),
+		testTask("B", "2021-03-04", 2),
+		testTask("C", "2021-03-04", 2),
+	)
+
+	// Links stored before the type could be edited
+	tasks["A"].Links = successorLinks("A", []PLinkData{
+		{Target: "B", Type: LinkFinishToStart},
+		{Target: "B", Type: LinkStartToStart},
+		{Target: "C", Type: LinkFinishToStart},
+		{Target: "C", Type: LinkFinishToStart},
+	})
+	if len(tasks["A"].Links) != 2 || tasks["A"].Links["A#B"].Type != LinkFinishToStart {
+		t.Fatalf("Expected only the first links to B and C to be kept, got %v", tasks["A"].Links)
+	}
+
+	sm := testStateManager(t, f, map[string]map[string]*PTask{"P": tasks})
+
+	// The same link created twice
+	id, err := sm.CreateLink("P", &Link{Source: "A", Target: "C", Type: LinkFinishToStart})
+	if err != nil || id != "A#C" {
+		t.Errorf("Expected the existing link A#C, got %q, %v", id, err)
+	}
+
+	if _, err := sm.CreateLink("P", &Link{Source: "A", Target: "C", Type: LinkFinishToFinish}); err == nil {
+		t.Errorf("A second link between the same tasks was accepted")
+	}
+	if len(edits.edits()) != 0 {
+		t.Errorf("Unexpected edits: %+v", edits.edits())
+	}
+
+	// The old IDs still find the link
+	if err := sm.DeleteLink("P", "A#B#0"); err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks["A"].Links) != 1 {
+		t.Errorf("Expected 1 link to remain, got %v", tasks["A"].Links)
+	}
+
+	imports := []struct {
+		successors string
+		links      []importLink
+	}{
+		{"2;2", []importLink{{"2", LinkFinishToStart, 0}}},
+		{"2;2:SS", nil},
+		{"2:FS+1;2", nil},
+	}
+	for _, test := range imports {
+		data := "id,name,successors\n1,First,\"" + test.successors + "\"\n2,Second,\n"
+		imported, err := parseImport(FormatCSV, []byte(data))
+		if err == nil {
+			imported, err = sortImport(imported)
+		}
+		if test.links == nil {
+			if err == nil {
+				t.Errorf("Import of %q accepted", test.successors)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, task := range imported {
+			if task.key == "1" && !reflect.DeepEqual(task.successors, test.links) {
+				t.Errorf("Expected the import of %q to link %+v, got %+v",
+					test.successors, test.links, task.successors)
+			}
+		}
+	}
+}
+
+func TestCrossProjectScheduling(t *testing.T) {
+	f := newFakeConduit(t)
+	f.handleEdits()
+
+	other := testTasks(testTask("A", "2021-03-01", 3))
+	own := testTasks(testTask("B", "2021-03-04", 2))
+	testLink(other, "A", "B", LinkFinishToStart, 0)
+
+	sm := testStateManager(t, f, map[string]map[string]*PTask{"P": own, "Q": other})
+	sm.opts.PGantt.AutoSchedule = true
+
+	// A in the other project holds B back
+	data, err := sm.CriticalPath("P")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data.Path) != 2 || data.Path[0] != "A" || data.Path[1] != "B" {
+		t.Errorf("Expected the path to run through A, got %v", data.Path)
+	}
+	if len(data.Tasks) != 1 || data.Tasks[0].Id != "B" {
+		t.Errorf("Expected only the dates of B, got %+v", data.Tasks)
+	}
+
+	// A cycle that has nothing to do with the edited task
+	other["X"] = testTask("X", "2021-03-01", 1)
+	other["Y"] = testTask("Y", "2021-03-01", 1)
+	testLink(other, "X", "Y", LinkFinishToStart, 0)
+	testLink(other, "Y", "X", LinkFinishToStart, 0)
+
+	edited := other["A"].Task
+	edited.Duration = 5
+	_, shifts, err := sm.EditTask("Q", &edited)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shifts) != 1 || shifts[0].Id != "B" || shifts[0].StartDate != "2021-03-08" {
+		t.Errorf("Expected B to move to 2021-03-08, got %+v", shifts)
+	}
+	if own["B"].Task.StartDate != "2021-03-08" {
+		t.Errorf("The cached B was not moved: %s", own["B"].Task.StartDate)
+	}
+}
+
+func TestCombinedPlanningData(t *testing.T) {
+	f := newFakeConduit(t)
+
+	first := testTasks(
+		testTask("A", "2021-03-01", 3),
+		testTask("B", "2021-03-04", 2),
+	)
+	second := testTasks(
+		testTask("C", "2021-03-08", 1),
+	)
+	// B is tagged with both projects
+	second["B"] = first["B"]
+	testLink(first, "A", "B", LinkFinishToStart, 0)
+	testLink(second, "B", "C", LinkFinishToStart, 0)
+
+	sm := testStateManager(t, f, map[string]map[string]*PTask{"P": first, "Q": second})
+	sm.projects = []Project{{Name: "First", Phid: "P"}, {Name: "Second", Phid: "Q"}}
+
+	if _, err := sm.CombinedPlanningData([]string{"P", "P"}); err == nil {
+		t.Errorf("A project requested twice was accepted")
+	}
+	if _, err := sm.CombinedPlanningData([]string{"P", "R"}); err == nil {
+		t.Errorf("An unknown project was accepted")
+	}
+
+	plan, err := sm.CombinedPlanningData([]string{"P", "Q"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string][2]string{
+		"A": {"P", "P"},
+		"B": {"P", "P"},
+		"C": {"Q", "Q"},
+		"P": {"P", "First"},
+		"Q": {"Q", "Second"},
+	}
+	if len(plan.Data) != len(expected) {
+		t.Fatalf("Expected %d rows, got %+v", len(expected), plan.Data)
+	}
+	for _, task := range plan.Data {
+		exp, ok := expected[task.Id]
+		if !ok {
+			t.Errorf("Unexpected row %s", task.Id)
+			continue
+		}
+		if task.Type == "project" {
+			if task.Text != exp[1] {
+				t.Errorf("Expected the summary of %s to be named %q, got %q", task.Id, exp[1], task.Text)
+			}
+		} else if task.Parent != exp[0] || task.Project != exp[0] {
+			t.Errorf("Expected %s under %s, got parent %q in %q", task.Id, exp[0], task.Parent, task.Project)
+		}
+	}
+
+	if len(plan.Links) != 2 || plan.Links[0].Id != "A#B" || plan.Links[1].Id != "B#C" {
+		t.Errorf("Expected each link once, got %+v", plan.Links)
+	}
+}
+
+func TestSyncCheckIsReadOnly(t *testing.T) {
+	f := newFakeConduit(t)
+	f.handleEdges(nil)
+	f.handle("maniphest.search", func(json.RawMessage) (interface{}, error) {
+		task := fakeTask(1, "PHID-TASK-1", "P", "Missed")
+		return map[string]interface{}{
+			"data":   []interface{}{task},
+			"cursor": map[string]interface{}{"after": nil},
+		}, nil
+	})
+
+	sm := testStateManager(t, f, map[string]map[string]*PTask{"P": testTasks()})
+	sm.readOnly = true
+	sm.opts.PGantt.CacheFile = filepath.Join(t.TempDir(), "cache.json")
+	events := sm.Subscribe("P")
+
+	changes, err := sm.SyncCheck()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].Type != EventTaskAdded || changes[0].Task.Id != "PHID-TASK-1" {
+		t.Errorf("Expected the missed task to be reported, got %+v", changes)
+	}
+	if evs := drainEvents(events); len(evs) != 0 {
+		t.Errorf("The changes were published: %+v", evs)
+	}
+	if _, err := os.Stat(sm.opts.PGantt.CacheFile); !os.IsNotExist(err) {
+		t.Errorf("The cache was written")
+	}
+}
+
+func TestEditTaskReportsSkippedCascade(t *testing.T) {
+	f := newFakeConduit(t)
+	edits := f.handleEdits()
+
+	tasks := testTasks(
+		testTask("A", "2021-03-01", 3),
+		testTask("B", "2021-03-04", 2),
+		testTask("C", "2021-03-08", 1),
+	)
+	testLink(tasks, "A", "B", LinkFinishToStart, 0)
+	testLink(tasks, "B", "C", LinkFinishToStart, 0)
+	testLink(tasks, "C", "B", LinkFinishToStart, 0)
+	sm := testStateManager(t, f, map[string]map[string]*PTask{"P": tasks})
+	sm.opts.PGantt.AutoSchedule = true
+
+	edited := tasks["A"].Task
+	edited.Duration = 5
+	_, shifts, err := sm.EditTask("P", &edited)
+	if _, ok := err.(*CascadeError); !ok {
+		t.Fatalf("Expected a cascade error, got %v", err)
+	}
+	if len(shifts) != 0 {
+		t.Errorf("Unexpected shifts: %+v", shifts)
+	}
+	if len(edits.edits()) != 1 || tasks["A"].Task.Duration != 5 {
+		t.Errorf("The edit itself was not saved")
+	}
+}
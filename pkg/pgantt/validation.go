@@ -0,0 +1,203 @@
+//------------------------------------------------------------------------------
+// Copyright (C) 2021 Daedalean AG
+//
+// This file is part of PGantt.
+//
+// PGantt is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// PGantt is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with PGantt.  If not, see <https://www.gnu.org/licenses/>.
+//------------------------------------------------------------------------------
+
+package pgantt
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Successors of every task, restricted to the tasks known in the map
+func linkGraph(tasks map[string]*PTask) map[string][]string {
+	graph := make(map[string][]string)
+	for id, ptask := range tasks {
+		succs := []string{}
+		for _, link := range ptask.Links {
+			if _, ok := tasks[link.Target]; ok {
+				succs = append(succs, link.Target)
+			}
+		}
+		sort.Strings(succs)
+		graph[id] = succs
+	}
+	return graph
+}
+
+// Find a chain of links leading from one task to another
+func findLinkPath(graph map[string][]string, from, to string) []string {
+	visited := make(map[string]bool)
+	var visit func(id string) []string
+	visit = func(id string) []string {
+		if id == to {
+			return []string{id}
+		}
+		if visited[id] {
+			return nil
+		}
+		visited[id] = true
+		for _, succ := range graph[id] {
+			if path := visit(succ); path != nil {
+				return append([]string{id}, path...)
+			}
+		}
+		return nil
+	}
+	return visit(from)
+}
+
+// Enumerate the cycles closed by the back edges of a depth-first search. Each
+// cycle is reported once, starting with its smallest task ID.
+func findCycles(graph map[string][]string) [][]string {
+	ids := make([]string, 0, len(graph))
+	for id := range graph {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	const (
+		white = iota
+		grey
+		black
+	)
+
+	color := make(map[string]int)
+	stack := []string{}
+	seen := make(map[string]bool)
+	cycles := [][]string{}
+
+	var visit func(id string)
+	visit = func(id string) {
+		color[id] = grey
+		stack = append(stack, id)
+		for _, succ := range graph[id] {
+			switch color[succ] {
+			case white:
+				visit(succ)
+			case grey:
+				start := len(stack) - 1
+				for stack[start] != succ {
+					start--
+				}
+				cycle := make([]string, len(stack)-start)
+				copy(cycle, stack[start:])
+
+				min := 0
+				for i := range cycle {
+					if cycle[i] < cycle[min] {
+						min = i
+					}
+				}
+				cycle = append(cycle[min:], cycle[:min]...)
+
+				key := strings.Join(cycle, "#")
+				if !seen[key] {
+					seen[key] = true
+					cycles = append(cycles, cycle)
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		color[id] = black
+	}
+
+	for _, id := range ids {
+		if color[id] == white {
+			visit(id)
+		}
+	}
+	return cycles
+}
+
+func describeTaskChain(tasks map[string]*PTask, chain []string) string {
+	names := make([]string, 0, len(chain))
+	for _, id := range chain {
+		names = append(names, fmt.Sprintf("%q", tasks[id].Task.Text))
+	}
+	return strings.Join(names, " -> ")
+}
+
+// Check if adding the link would close a dependency cycle
+func checkLinkCycle(tasks map[string]*PTask, link *Link) error {
+	path := findLinkPath(linkGraph(tasks), link.Target, link.Source)
+	if path == nil {
+		return nil
+	}
+	return fmt.Errorf("The link would create a dependency cycle: %s",
+		describeTaskChain(tasks, append([]string{link.Source}, path...)))
+}
+
+func validateTasks(tasks, all map[string]*PTask, cal *Calendar) *ValidationReport {
+	report := &ValidationReport{}
+	report.Cycles = make([][]string, 0)
+	report.Dangling = make([]Link, 0)
+	report.Violations = make([]LinkViolation, 0)
+
+	// The links may cross the project boundaries, so the cycles are searched
+	// for among the tasks of all the projects
+	for _, cycle := range findCycles(linkGraph(all)) {
+		for _, id := range cycle {
+			if _, ok := tasks[id]; ok {
+				report.Cycles = append(report.Cycles, cycle)
+				break
+			}
+		}
+	}
+
+	nodes := make(map[string]*scheduleNode)
+	for id, ptask := range all {
+		if node, _ := newScheduleNode(&ptask.Task, cal); node != nil {
+			nodes[id] = node
+		}
+	}
+
+	for id, ptask := range tasks {
+		for _, link := range ptask.Links {
+			if _, ok := all[link.Target]; !ok {
+				report.Dangling = append(report.Dangling, *link)
+				continue
+			}
+
+			pred, ok := nodes[id]
+			if !ok {
+				continue
+			}
+			succ, ok := nodes[link.Target]
+			if !ok {
+				continue
+			}
+
+			if es := earliestStartAfter(cal, link, pred, succ); succ.es < es {
+				overlap := cal.Workdays(succ.es, es, succ.user)
+				report.Violations = append(report.Violations, LinkViolation{*link, overlap})
+			}
+		}
+	}
+
+	sort.Slice(report.Dangling, func(i, j int) bool {
+		return report.Dangling[i].Id < report.Dangling[j].Id
+	})
+
+	sort.Slice(report.Violations, func(i, j int) bool {
+		return report.Violations[i].Link.Id < report.Violations[j].Link.Id
+	})
+
+	return report
+}
@@ -0,0 +1,106 @@
+//------------------------------------------------------------------------------
+// Copyright (C) 2021 Daedalean AG
+//
+// This file is part of PGantt.
+//
+// PGantt is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// PGantt is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with PGantt.  If not, see <https://www.gnu.org/licenses/>.
+//------------------------------------------------------------------------------
+
+package pgantt
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckLinkCycle(t *testing.T) {
+	tasks := testTasks(
+		testTask("A", "2021-03-01", 1),
+		testTask("B", "2021-03-02", 1),
+		testTask("C", "2021-03-03", 1),
+	)
+	testLink(tasks, "A", "B", LinkFinishToStart, 0)
+	testLink(tasks, "B", "C", LinkFinishToStart, 0)
+
+	err := checkLinkCycle(tasks, &Link{Source: "C", Target: "A"})
+	if err == nil {
+		t.Fatal("A link closing a cycle was accepted")
+	}
+	if !strings.Contains(err.Error(), `"C" -> "A" -> "B" -> "C"`) {
+		t.Errorf("The error does not describe the cycle: %s", err)
+	}
+
+	if err := checkLinkCycle(tasks, &Link{Source: "A", Target: "C"}); err != nil {
+		t.Errorf("A parallel link was rejected: %s", err)
+	}
+	if err := checkLinkCycle(tasks, &Link{Source: "A", Target: "A"}); err == nil {
+		t.Errorf("A link of a task to itself was accepted")
+	}
+}
+
+func TestCreateLinkRejectsCycles(t *testing.T) {
+	f := newFakeConduit(t)
+	edits := f.handleEdits()
+
+	tasks := testTasks(
+		testTask("A", "2021-03-01", 1),
+		testTask("B", "2021-03-02", 1),
+	)
+	testLink(tasks, "A", "B", LinkFinishToStart, 0)
+	sm := testStateManager(t, f, map[string]map[string]*PTask{"P": tasks})
+
+	if _, err := sm.CreateLink("P", &Link{Source: "B", Target: "A", Type: LinkFinishToStart}); err == nil {
+		t.Errorf("A cyclic link was created")
+	}
+	if len(edits.edits()) != 0 || len(tasks["B"].Links) != 0 {
+		t.Errorf("The cyclic link made it to Phabricator or to the cache")
+	}
+}
+
+func TestValidateTasks(t *testing.T) {
+	cal := testCalendar(t)
+	tasks := testTasks(
+		testTask("A", "2021-03-01", 3),
+		testTask("B", "2021-03-02", 2),
+		testTask("C", "2021-03-08", 1),
+		testTask("D", "2021-03-08", 1),
+	)
+	// B starts 2 working days before A finishes
+	testLink(tasks, "A", "B", LinkFinishToStart, 0)
+	testLink(tasks, "B", "C", LinkFinishToStart, 0)
+	testLink(tasks, "C", "D", LinkFinishToStart, 0)
+	testLink(tasks, "D", "C", LinkFinishToStart, 0)
+	testLink(tasks, "A", "X", LinkFinishToStart, 0)
+
+	report := validateTasks(tasks, tasks, cal)
+
+	if !reflect.DeepEqual(report.Cycles, [][]string{{"C", "D"}}) {
+		t.Errorf("Expected the C, D cycle, got %v", report.Cycles)
+	}
+	if len(report.Dangling) != 1 || report.Dangling[0].Target != "X" {
+		t.Errorf("Expected the link to X to be dangling, got %+v", report.Dangling)
+	}
+
+	overlaps := make(map[string]int)
+	for _, v := range report.Violations {
+		overlaps[v.Link.Id] = v.Overlap
+	}
+	if overlaps["A#B"] != 2 {
+		t.Errorf("Expected A#B to overlap by 2 working days, got %v", overlaps)
+	}
+	if _, ok := overlaps["B#C"]; ok {
+		t.Errorf("B#C is not violated: %v", overlaps)
+	}
+}
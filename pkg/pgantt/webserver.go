@@ -24,8 +24,12 @@ package pgantt
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"path"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/ljanyst/go-srvutils/fs"
 	log "github.com/sirupsen/logrus"
@@ -37,8 +41,10 @@ type Response struct {
 }
 
 type ActionStatus struct {
-	Action string `json:"action"`
-	Tid    string `json:"tid,omitempty"`
+	Action  string      `json:"action"`
+	Tid     string      `json:"tid,omitempty"`
+	Cascade []TaskShift `json:"cascade,omitempty"`
+	Warning string      `json:"warning,omitempty"`
 }
 
 type StateHandler struct {
@@ -70,6 +76,73 @@ func writeError(w http.ResponseWriter, code int, err error) {
 	w.Write(bytes)
 }
 
+// Tell the client that its edit was based on stale data and send it the
+// current state of the task so that the changes can be merged
+func writeConflict(w http.ResponseWriter, err *ConflictError) {
+	resp := Response{
+		"CONFLICT",
+		struct {
+			Message string `json:"message"`
+			Task    Task   `json:"task"`
+		}{err.Error(), err.Task},
+	}
+	log.Infof("Rejecting a stale edit: %s", err)
+
+	bytes, e := json.Marshal(resp)
+	if e != nil {
+		log.Errorf("Cannot serialize conflict respense: %s", e)
+		return
+	}
+
+	setupHeader(w)
+	w.WriteHeader(http.StatusConflict)
+	w.Write(bytes)
+}
+
+// Send the data as a file to be downloaded
+func writeFile(w http.ResponseWriter, contentType, fileName string, data []byte) {
+	setupHeader(w)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// Serve <phid><ext> in the format given by the extension. The contentTypes
+// list the supported extensions, kind describes the files in the error
+// messages, and the files are offered for download if attachment is set.
+// The render function returns nil for an unknown project.
+func serveFile(w http.ResponseWriter, r *http.Request, kind string, contentTypes map[string]string,
+	attachment bool, render func(phid, format string) ([]byte, error)) {
+
+	ext := path.Ext(r.URL.Path)
+	contentType, ok := contentTypes[ext]
+	if !ok {
+		writeError(w, 404, fmt.Errorf("Unsupported %s format: %q", kind, ext))
+		return
+	}
+
+	phid := strings.TrimSuffix(r.URL.Path, ext)
+	data, err := render(phid, ext[1:])
+	if err != nil {
+		writeError(w, 400, err)
+		return
+	}
+	if data == nil {
+		writeError(w, 404, fmt.Errorf("Unknown project %s", phid))
+		return
+	}
+
+	if attachment {
+		writeFile(w, contentType, phid+ext, data)
+		return
+	}
+	setupHeader(w)
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
 func writeData(w http.ResponseWriter, data interface{}) {
 	resp := Response{
 		"SUCCESS",
@@ -87,15 +160,46 @@ func writeData(w http.ResponseWriter, data interface{}) {
 }
 
 type ProjectsHandler StateHandler
+type UsersHandler StateHandler
+type CalendarHandler StateHandler
 type PlanProvider StateHandler
 type PlanEditor StateHandler
+type CriticalPathProvider StateHandler
+type ValidationProvider StateHandler
+type EventStreamer StateHandler
+type ResourceProvider StateHandler
+type BaselineHandler StateHandler
+type ExportProvider StateHandler
+type Importer StateHandler
+type ICalProvider StateHandler
+type ChartRenderer StateHandler
+type ReportProvider StateHandler
 
 func (h ProjectsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	projects := h.s.Projects()
 	writeData(w, projects)
 }
 
+func (h UsersHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	users := h.s.Users()
+	writeData(w, users)
+}
+
+func (h CalendarHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	writeData(w, h.s.WorkCalendar())
+}
+
 func (h PlanProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if projects := r.URL.Query().Get("projects"); projects != "" {
+		planning, err := h.s.CombinedPlanningData(strings.Split(projects, ","))
+		if err != nil {
+			writeError(w, 404, err)
+			return
+		}
+		writeData(w, planning)
+		return
+	}
+
 	planning := h.s.PlanningData(r.URL.Path)
 	if planning == nil {
 		writeError(w, 404, fmt.Errorf("Unknown project %s", r.URL.Path))
@@ -104,6 +208,255 @@ func (h PlanProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	writeData(w, planning)
 }
 
+func (h CriticalPathProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	cp, err := h.s.CriticalPath(r.URL.Path)
+	if err != nil {
+		writeError(w, 400, err)
+		return
+	}
+	if cp == nil {
+		writeError(w, 404, fmt.Errorf("Unknown project %s", r.URL.Path))
+		return
+	}
+	writeData(w, cp)
+}
+
+func (h ValidationProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	report := h.s.Validate(r.URL.Path)
+	if report == nil {
+		writeError(w, 404, fmt.Errorf("Unknown project %s", r.URL.Path))
+		return
+	}
+	writeData(w, report)
+}
+
+func (h ResourceProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	report := h.s.Resources(r.URL.Path)
+	if report == nil {
+		writeError(w, 404, fmt.Errorf("Unknown project %s", r.URL.Path))
+		return
+	}
+	writeData(w, report)
+}
+
+// Baselines of a project: GET <phid> lists them, POST <phid> saves a new one,
+// and GET <phid>/<name> compares the current plan against the baseline
+func (h BaselineHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		setupHeader(w)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	phid, name := r.URL.Path, ""
+	if i := strings.Index(phid, "/"); i != -1 {
+		phid, name = phid[:i], phid[i+1:]
+	}
+
+	var data interface{}
+	var err error
+	switch {
+	case r.Method == "GET" && name == "":
+		var baselines []BaselineInfo
+		baselines, err = h.s.Baselines(phid)
+		if baselines != nil {
+			data = baselines
+		}
+	case r.Method == "GET":
+		var report *VarianceReport
+		report, err = h.s.Variance(phid, name)
+		if report != nil {
+			data = report
+		}
+	case r.Method == "POST" && name == "":
+		var req struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, 400, err)
+			return
+		}
+		var info *BaselineInfo
+		info, err = h.s.SaveBaseline(phid, req.Name)
+		if info != nil {
+			data = info
+		}
+	default:
+		writeError(w, 400, fmt.Errorf("Unsupported %s request for %q", r.Method, r.URL.Path))
+		return
+	}
+
+	if err != nil {
+		writeError(w, 400, err)
+		return
+	}
+	if data == nil {
+		writeError(w, 404, fmt.Errorf("Unknown project %s", phid))
+		return
+	}
+	writeData(w, data)
+}
+
+func (h ExportProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	contentTypes := map[string]string{
+		"." + FormatCSV:   "text/csv",
+		"." + FormatJSON:  "application/json",
+		"." + FormatMSPDI: "application/xml",
+	}
+	serveFile(w, r, "export", contentTypes, true, h.s.Export)
+}
+
+func (h ICalProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	contentTypes := map[string]string{
+		".ics": "text/calendar; charset=utf-8",
+	}
+	all := r.URL.Query().Get("all") == "1"
+	serveFile(w, r, "calendar", contentTypes, true, func(phid, format string) ([]byte, error) {
+		return h.s.ICal(phid, all), nil
+	})
+}
+
+// Draw the chart as <phid>.svg or <phid>.png, the range can be chosen with the
+// from and to query parameters, and the scale with the zoom parameter
+func (h ChartRenderer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	contentTypes := map[string]string{
+		".svg": "image/svg+xml",
+		".png": "image/png",
+	}
+
+	query := r.URL.Query()
+	opts := &RenderOpts{
+		From:   query.Get("from"),
+		To:     query.Get("to"),
+		Zoom:   query.Get("zoom"),
+		Closed: query.Get("closed") == "1",
+	}
+
+	serveFile(w, r, "image", contentTypes, false, func(phid, format string) ([]byte, error) {
+		return h.s.Render(phid, format, opts)
+	})
+}
+
+// Status report of the project as <phid>.md, <phid>.html or <phid>.json,
+// covering the milestones of the number of weeks given by the weeks query
+// parameter
+func (h ReportProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	contentTypes := map[string]string{
+		".md":   "text/markdown; charset=utf-8",
+		".html": "text/html; charset=utf-8",
+		".json": "application/json",
+	}
+
+	weeks := 4
+	if val := r.URL.Query().Get("weeks"); val != "" {
+		var err error
+		if weeks, err = strconv.Atoi(val); err != nil || weeks < 0 {
+			writeError(w, 400, fmt.Errorf("Invalid number of weeks: %q", val))
+			return
+		}
+	}
+
+	serveFile(w, r, "report", contentTypes, false, func(phid, format string) ([]byte, error) {
+		report, err := h.s.StatusReport(phid, weeks)
+		if report == nil || err != nil {
+			return nil, err
+		}
+		if format == "json" {
+			return json.MarshalIndent(report, "", "  ")
+		}
+		return FormatStatusReport(report, format)
+	})
+}
+
+// Import the MSPDI or CSV file POSTed to <phid>, the format and the dry-run
+// mode can be chosen with the format and dry_run query parameters
+func (h Importer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		setupHeader(w)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != "POST" {
+		writeError(w, 400, fmt.Errorf("Unsupported %s request", r.Method))
+		return
+	}
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, 400, err)
+		return
+	}
+
+	query := r.URL.Query()
+	dryRun := query.Get("dry_run") == "1" || query.Get("dry_run") == "true"
+	if !dryRun {
+		defer h.s.SyncTasks()
+	}
+
+	report, err := h.s.Import(r.URL.Path, query.Get("format"), data, dryRun)
+	if err != nil {
+		writeError(w, 400, err)
+		return
+	}
+	if report == nil {
+		writeError(w, 404, fmt.Errorf("Unknown project %s", r.URL.Path))
+		return
+	}
+	writeData(w, report)
+}
+
+// Push the changes of a project's plan as Server-Sent Events
+func (h EventStreamer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, 500, fmt.Errorf("Streaming is not supported"))
+		return
+	}
+
+	phid := r.URL.Path
+	known := false
+	for _, proj := range h.s.Projects() {
+		if proj.Phid == phid {
+			known = true
+			break
+		}
+	}
+
+	if !known {
+		writeError(w, 404, fmt.Errorf("Unknown project %s", phid))
+		return
+	}
+
+	events := h.s.Subscribe(phid)
+	defer h.s.Unsubscribe(events)
+
+	setupHeader(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprintf(w, ": keep-alive\n\n")
+		case ev := <-events:
+			data, err := json.Marshal(ev)
+			if err != nil {
+				log.Errorf("Cannot serialize event: %s", err)
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data)
+		}
+		flusher.Flush()
+	}
+}
+
 func (h PlanEditor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "OPTIONS" {
 		setupHeader(w)
@@ -123,8 +476,27 @@ func (h PlanEditor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	status := ActionStatus{}
 	var err error
 	var id string
+	var shifts []TaskShift
 
 	if typ == "task" {
+		if r.Method == "DELETE" {
+			var taskId string
+			err = json.NewDecoder(r.Body).Decode(&taskId)
+			if err != nil {
+				writeError(w, 400, err)
+				return
+			}
+
+			err = h.s.DeleteTask(phid, taskId)
+			if err != nil {
+				writeError(w, 400, err)
+				return
+			}
+
+			writeData(w, ActionStatus{Action: "deleted"})
+			return
+		}
+
 		var task Task
 		err = json.NewDecoder(r.Body).Decode(&task)
 		if err != nil {
@@ -132,13 +504,14 @@ func (h PlanEditor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		if r.Method == "DELETE" {
-			writeError(w, 400, fmt.Errorf("Task deletion is not supported"))
+		id, shifts, err = h.s.EditTask(phid, &task)
+		if conflict, ok := err.(*ConflictError); ok {
+			writeConflict(w, conflict)
 			return
 		}
-
-		id, err = h.s.EditTask(phid, &task)
-		if err != nil {
+		if cascade, ok := err.(*CascadeError); ok {
+			status.Warning = cascade.Error()
+		} else if err != nil {
 			writeError(w, 400, err)
 			return
 		}
@@ -159,7 +532,7 @@ func (h PlanEditor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 
-			writeData(w, ActionStatus{"deleted", ""})
+			writeData(w, ActionStatus{Action: "deleted"})
 			return
 		}
 
@@ -171,11 +544,10 @@ func (h PlanEditor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 
 		if r.Method == "PUT" {
-			writeError(w, 400, fmt.Errorf("Link edition is not supported"))
-			return
+			err = h.s.UpdateLink(phid, &link)
+		} else {
+			id, err = h.s.CreateLink(phid, &link)
 		}
-
-		id, err = h.s.CreateLink(phid, &link)
 		if err != nil {
 			writeError(w, 400, err)
 			return
@@ -188,16 +560,30 @@ func (h PlanEditor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	} else {
 		status.Action = "updated"
 	}
+	status.Cascade = shifts
 	writeData(w, status)
 }
 
 func RunWebServer(sm *StateManager, opts *Opts) {
-	assets := &fs.Index404Fs{Assets}
+	assets := &fs.Index404Fs{Fs: Assets}
 	ui := http.FileServer(assets)
 	http.Handle("/", ui)
 	http.Handle("/api/projects", ProjectsHandler{sm})
+	http.Handle("/api/users", UsersHandler{sm})
+	http.Handle("/api/calendar", CalendarHandler{sm})
+	http.Handle("/api/plan", PlanProvider{sm})
 	http.Handle("/api/plan/", http.StripPrefix("/api/plan/", PlanProvider{sm}))
 	http.Handle("/api/edit/", http.StripPrefix("/api/edit/", PlanEditor{sm}))
+	http.Handle("/api/criticalpath/", http.StripPrefix("/api/criticalpath/", CriticalPathProvider{sm}))
+	http.Handle("/api/events/", http.StripPrefix("/api/events/", EventStreamer{sm}))
+	http.Handle("/api/resources/", http.StripPrefix("/api/resources/", ResourceProvider{sm}))
+	http.Handle("/api/validate/", http.StripPrefix("/api/validate/", ValidationProvider{sm}))
+	http.Handle("/api/baseline/", http.StripPrefix("/api/baseline/", BaselineHandler{sm}))
+	http.Handle("/api/export/", http.StripPrefix("/api/export/", ExportProvider{sm}))
+	http.Handle("/api/import/", http.StripPrefix("/api/import/", Importer{sm}))
+	http.Handle("/api/ical/", http.StripPrefix("/api/ical/", ICalProvider{sm}))
+	http.Handle("/api/render/", http.StripPrefix("/api/render/", ChartRenderer{sm}))
+	http.Handle("/api/report/", http.StripPrefix("/api/report/", ReportProvider{sm}))
 	addressString := fmt.Sprintf("localhost:%d", opts.PGantt.Port)
 	log.Infof("Serving at: http://%s", addressString)
 	log.Fatal("Server failure: ", http.ListenAndServe(addressString, nil))
@@ -0,0 +1,173 @@
+//------------------------------------------------------------------------------
+// Copyright (C) 2021 Daedalean AG
+//
+// This file is part of PGantt.
+//
+// PGantt is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// PGantt is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with PGantt.  If not, see <https://www.gnu.org/licenses/>.
+//------------------------------------------------------------------------------
+
+package pgantt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+)
+
+// Nothing has changed in Phabricator since the last sync
+func (f *fakeConduit) handleNoChanges() {
+	f.handle("maniphest.search", func(json.RawMessage) (interface{}, error) {
+		return map[string]interface{}{
+			"data":   []interface{}{},
+			"cursor": map[string]interface{}{"after": nil},
+		}, nil
+	})
+}
+
+// Send the task or the link to the edit API of the project
+func sendEdit(t *testing.T, sm *StateManager, method, path string, body interface{}) (int, map[string]interface{}) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(method, "/api/edit/"+path, bytes.NewReader(data))
+	r.URL.Path = path
+	PlanEditor{sm}.ServeHTTP(w, r)
+
+	resp := struct {
+		Status string                 `json:"status"`
+		Data   map[string]interface{} `json:"data"`
+	}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Malformed response %q: %s", w.Body, err)
+	}
+	return w.Code, resp.Data
+}
+
+func TestPlanEditorWarnsAboutSkippedCascade(t *testing.T) {
+	f := newFakeConduit(t)
+	f.handleEdits()
+	f.handleNoChanges()
+
+	tasks := testTasks(
+		testTask("A", "2021-03-01", 3),
+		testTask("B", "2021-03-04", 2),
+	)
+	testLink(tasks, "A", "B", LinkFinishToStart, 0)
+	testLink(tasks, "B", "A", LinkFinishToStart, 0)
+	sm := testStateManager(t, f, map[string]map[string]*PTask{"P": tasks})
+	sm.opts.PGantt.AutoSchedule = true
+
+	edited := tasks["A"].Task
+	edited.Duration = 5
+	code, data := sendEdit(t, sm, "PUT", "P/task", edited)
+	if code != 200 {
+		t.Fatalf("Expected the edit to succeed, got %d: %v", code, data)
+	}
+	if warning, _ := data["warning"].(string); warning == "" {
+		t.Errorf("Expected a warning about the successors, got %v", data)
+	}
+}
+
+// The second edit made from the same version does not overwrite the first one
+func TestPlanEditorRejectsStaleEdit(t *testing.T) {
+	f := newFakeConduit(t)
+	edits := f.handleEdits()
+	f.handleNoChanges()
+
+	tasks := testTasks(testTask("A", "2021-03-01", 3))
+	tasks["A"].Mtime = 1000
+	tasks["A"].Task.Version = 1000
+	sm := testStateManager(t, f, map[string]map[string]*PTask{"P": tasks})
+
+	first := tasks["A"].Task
+	first.Duration = 4
+	if code, data := sendEdit(t, sm, "PUT", "P/task", first); code != 200 {
+		t.Fatalf("Expected the first edit to succeed, got %d: %v", code, data)
+	}
+
+	second := tasks["A"].Task
+	second.Version = 1000
+	second.Text = "Renamed"
+	code, data := sendEdit(t, sm, "PUT", "P/task", second)
+	if code != 409 {
+		t.Fatalf("Expected a conflict, got %d: %v", code, data)
+	}
+	current, _ := data["task"].(map[string]interface{})
+	if current["duration"] != 4.0 {
+		t.Errorf("Expected the conflict to carry the first edit, got %v", current)
+	}
+	if len(edits.edits()) != 1 {
+		t.Errorf("Expected a single edit to reach Phabricator, got %d", len(edits.edits()))
+	}
+}
+
+func TestServeFile(t *testing.T) {
+	contentTypes := map[string]string{
+		".txt": "text/plain",
+	}
+	render := func(phid, format string) ([]byte, error) {
+		switch phid {
+		case "P":
+			return []byte(phid + " as " + format), nil
+		case "broken":
+			return nil, fmt.Errorf("Cannot render %s", phid)
+		}
+		return nil, nil
+	}
+
+	tests := []struct {
+		path        string
+		attachment  bool
+		code        int
+		body        string
+		disposition string
+	}{
+		{"P.txt", false, 200, "P as txt", ""},
+		{"P.txt", true, 200, "P as txt", `attachment; filename="P.txt"`},
+		{"P.pdf", false, 404, "", ""},
+		{"P", false, 404, "", ""},
+		{"Q.txt", false, 404, "", ""},
+		{"broken.txt", false, 400, "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%s %v", test.path, test.attachment), func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "/api/test/"+test.path, nil)
+			r.URL.Path = test.path
+			serveFile(w, r, "test", contentTypes, test.attachment, render)
+
+			if w.Code != test.code {
+				t.Fatalf("Expected status %d, got %d: %s", test.code, w.Code, w.Body)
+			}
+			if test.code != 200 {
+				return
+			}
+			if w.Body.String() != test.body {
+				t.Errorf("Expected %q, got %q", test.body, w.Body)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "text/plain" {
+				t.Errorf("Expected text/plain, got %q", ct)
+			}
+			if cd := w.Header().Get("Content-Disposition"); cd != test.disposition {
+				t.Errorf("Expected the disposition %q, got %q", test.disposition, cd)
+			}
+		})
+	}
+}
@@ -25,7 +25,7 @@ import { connect } from 'react-redux';
 
 import { planSet } from '../actions/planning';
 import {
-  planGet, taskCreate, taskEdit, taskDelete, linkCreate, linkEdit, linkDelete
+  calendarGet, planGet, taskCreate, taskEdit, taskDelete, linkCreate, linkEdit, linkDelete
 } from '../utils/api';
 import { objectEquals, sanitizeTask, sanitizeLink } from '../utils/helpers';
 
@@ -41,16 +41,32 @@ class Gantt extends Component {
       .catch(msg => message.error(msg.toString()));
   }
 
+  // Count the durations in the same working days as the server. The
+  // vacations are not known to the chart, so the tasks of the people on
+  // vacation may still be drawn shorter than their finish dates.
+  setCalendar(calendar) {
+    const strToDate = gantt.date.str_to_date(gantt.config.date_format);
+    for (var day = 0; day < 7; day++) {
+      gantt.setWorkTime({day: day, hours: !calendar.weekend.includes(day)});
+    }
+    calendar.holidays.forEach(date => {
+      gantt.setWorkTime({date: strToDate(date), hours: false});
+    });
+  }
+
   componentDidMount() {
+    gantt.config.work_time = true;
+    gantt.config.duration_unit = "day";
+
     gantt.templates.scale_cell_class = (date) => {
-      if (date.getDay() == 0 || date.getDay() == 6) {
+      if (!gantt.isWorkTime(date, "day")) {
         return "weekend";
       }
       return null;
     };
 
     gantt.templates.timeline_cell_class = (item, date) => {
-      if (date.getDay() == 0 || date.getDay() == 6) {
+      if (!gantt.isWorkTime(date, "day")) {
         return "weekend";
       }
       return null;
@@ -91,6 +107,7 @@ class Gantt extends Component {
         section_details: "Details",
         section_title: "Title",
         section_column: "Column",
+        section_owner: "Assigned To",
         section_parent: "Parent"
       }
     });
@@ -102,6 +119,14 @@ class Gantt extends Component {
       return "";
     };
 
+    gantt.templates.task_class = (start, end, task) => {
+      return task.external ? "external" : "";
+    };
+
+    gantt.templates.grid_row_class = (start, end, task) => {
+      return task.external ? "external" : "";
+    };
+
     gantt.config.grid_width = 420;
     gantt.config.row_height = 24;
     gantt.config.grid_resize = true;
@@ -118,6 +143,9 @@ class Gantt extends Component {
 
     gantt.attachEvent("onBeforeLightbox", (id) => {
       var task = gantt.getTask(id);
+      if (task.external) {
+        return false;
+      }
       task.details = `<b>URL:</b> <a href="${task.url}">${task.url}</a>`;
       if (typeof task.id === "number") {
         task.unscheduled = true;
@@ -132,14 +160,23 @@ class Gantt extends Component {
       throw err;
     };
 
+    const logWarning = data => {
+      if (data && data.warning) {
+        message.warning(data.warning);
+      }
+      return data;
+    };
+
     this.dataProcessor = gantt.createDataProcessor({
       task: {
         create: (data) => {
           return taskCreate(this.props.phid, sanitizeTask(data))
+            .then(logWarning)
             .catch(logError);
         },
         update: (data, id) => {
           return taskEdit(this.props.phid, sanitizeTask(data))
+            .then(logWarning)
             .catch(logError);
         },
         delete: (id) => {
@@ -183,8 +220,13 @@ class Gantt extends Component {
     });
     gantt.config.buttons_left = [];
     gantt.config.buttons_right = ["gantt_cancel_btn", "gantt_save_btn"];
-    this.fetchData();
-    setInterval(() => this.fetchData(), 1000);
+    calendarGet()
+      .then(data => this.setCalendar(data.data))
+      .catch(msg => message.error(msg.toString()))
+      .then(() => {
+        this.fetchData();
+        setInterval(() => this.fetchData(), 1000);
+      });
   }
 
   setZoom(value) {
@@ -266,6 +308,10 @@ class Gantt extends Component {
       return true;
     }
 
+    if (this.props.users !== nextProps.users) {
+      return true;
+    }
+
     const newTaskIds = new Set(nextProps.plan.data.map(item => item.id));
     this.tasksToRemove = this.props.plan.data
       .map(item => item.id)
@@ -322,12 +368,18 @@ class Gantt extends Component {
       return {key: obj.phid, label: obj.name};
     });
 
+    const owners = [{key: "", label: "Unassigned"}].concat(
+      this.props.users.map((obj) => {
+        return {key: obj.phid, label: `${obj.name} (${obj.real_name})`};
+      }));
+
     const fields = [
       {name: "title", height: 70, map_to: "text", type: "textarea", focus: true},
       {name: "details", height: 16, type: "template", map_to: "details"},
       {name: "type", type: "typeselect", map_to: "type"},
       {name: "parent", type: "parent", allow_root: "true", root_label: "No parent"},
       {name: "column", height:22, map_to: "column", type: "select", options: columns},
+      {name: "owner", height:22, map_to: "owner", type: "select", options: owners},
       {name: "time", map_to: "auto", button: true, type: "duration_optional"}
     ];
 
@@ -383,6 +435,7 @@ function mapStateToProps(state, ownProps) {
   return {
     plan: state.planning,
     project: proj.length !== 0 ? proj[0] : null,
+    users: state.users,
     startDate: state.settings.startDate,
     endDate: state.settings.endDate,
     zoom: state.settings.zoom,
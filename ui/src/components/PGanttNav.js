@@ -24,7 +24,8 @@ import { connect } from 'react-redux';
 import { Link } from 'react-router-dom';
 
 import { projectsSet } from '../actions/projects';
-import { projectsGet } from '../utils/api';
+import { usersSet } from '../actions/users';
+import { projectsGet, usersGet } from '../utils/api';
 
 const { SubMenu } = Menu;
 
@@ -40,6 +41,9 @@ class PGanttNav extends Component {
     projectsGet()
       .then(data => this.props.projectsSet(data.data))
       .catch(msg => message.error(msg.toString()));
+    usersGet()
+      .then(data => this.props.usersSet(data.data))
+      .catch(msg => message.error(msg.toString()));
   }
 
   render() {
@@ -78,7 +82,8 @@ function mapStateToProps(state) {
 
 function mapDispatchToProps(dispatch) {
   return {
-    projectsSet: (data) => dispatch(projectsSet(data))
+    projectsSet: (data) => dispatch(projectsSet(data)),
+    usersSet: (data) => dispatch(usersSet(data))
   };
 }
 
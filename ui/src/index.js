@@ -32,12 +32,14 @@ import PGanttApp from './components/PGanttApp';
 import { projectsReducer } from './reducers/projects';
 import { planningReducer } from './reducers/planning';
 import { settingsReducer } from './reducers/settings';
+import { usersReducer } from './reducers/users';
 
 export const store = createStore(
   combineReducers({
     projects: projectsReducer,
     planning: planningReducer,
     settings: settingsReducer,
+    users: usersReducer,
   }),
   window.__REDUX_DEVTOOLS_EXTENSION__ && window.__REDUX_DEVTOOLS_EXTENSION__()
 );
@@ -34,6 +34,9 @@ const responseHandler = (response) => {
       throw Error(response.error);
     }
     return response.json().then(body => {
+      if (body.status === 'CONFLICT') {
+        throw Error(body.data.message);
+      }
       throw Error(body.data);
     });
   }
@@ -46,6 +49,18 @@ export const projectsGet = () => {
     .then(responseHandler);
 };
 
+export const usersGet = () => {
+  const url = `${api}/users`;
+  return fetch(url, { headers })
+    .then(responseHandler);
+};
+
+export const calendarGet = () => {
+  const url = `${api}/calendar`;
+  return fetch(url, { headers })
+    .then(responseHandler);
+};
+
 export const planGet = (phid) => {
   const url = `${api}/plan/${phid}`;
   return fetch(url, { headers })
@@ -75,7 +90,14 @@ export const taskEdit = (phid, data) => {
 };
 
 export const taskDelete = (phid, id) => {
-  return Promise.reject(new Error("You cannot delete tasks."));
+  const url = `${api}/edit/${phid}/task`;
+  return fetch(url, {
+    method: "DELETE",
+    headers,
+    body: JSON.stringify(id)
+  })
+    .then(responseHandler)
+    .then(extractData);
 };
 
 export const linkCreate = (phid, data) => {
@@ -90,7 +112,14 @@ export const linkCreate = (phid, data) => {
 };
 
 export const linkEdit = (phid, data) => {
-  return Promise.reject(new Error("You cannot edit links."));
+  const url = `${api}/edit/${phid}/link`;
+  return fetch(url, {
+    method: "PUT",
+    headers,
+    body: JSON.stringify(data)
+  })
+    .then(responseHandler)
+    .then(extractData);
 };
 
 export const linkDelete = (phid, id) => {